@@ -0,0 +1,143 @@
+package bimg
+
+/*
+#cgo pkg-config: vips
+#include "vips/vips.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"math"
+)
+
+// NewCanvas creates an image of the given size filled with a single colour,
+// to be used as a placeholder or as a background for Layer compositing.
+// The image is encoded as PNG unless another type is given.
+func NewCanvas(width, height int, color ColorRGBA, t ImageType) ([]byte, error) {
+	defer C.vips_thread_shutdown()
+
+	if err := checkCanvasSize(width, height); err != nil {
+		return nil, err
+	}
+
+	image, err := vipsCanvas(width, height, color)
+	if err != nil {
+		return nil, err
+	}
+
+	return saveNewImage(image, t, Quality)
+}
+
+// NewGradient creates an image of the given size filled with a linear or
+// radial gradient. The image is encoded as PNG unless another type is given.
+func NewGradient(width, height int, g Gradient, t ImageType) ([]byte, error) {
+	defer C.vips_thread_shutdown()
+
+	if err := checkCanvasSize(width, height); err != nil {
+		return nil, err
+	}
+
+	var p0, p1, p2 float64
+	switch g.Type {
+	case GradientLinear:
+		p0, p1, p2 = calculateLinearGradient(width, height, g.Angle)
+	case GradientRadial:
+		if g.Radius < 0 {
+			return nil, errors.New("Gradient radius cannot be negative")
+		}
+		p0, p1, p2 = calculateRadialGradient(width, height, g)
+	default:
+		return nil, errors.New("Invalid gradient type")
+	}
+
+	image, err := vipsGradient(width, height, g.Type == GradientRadial, p0, p1, p2, g.Start, g.End)
+	if err != nil {
+		return nil, err
+	}
+
+	return saveNewImage(image, t, Quality)
+}
+
+func checkCanvasSize(width, height int) error {
+	if width <= 0 || height <= 0 {
+		return errors.New("Width and height must be higher than zero")
+	}
+	if width > maxSize || height > maxSize {
+		return errors.New("Maximum image size exceeded")
+	}
+	return nil
+}
+
+// calculateLinearGradient returns the coefficients of x and y, and the
+// offset, which give the position along a linear gradient of the given
+// angle, from 0 in the first corner it reaches to 1 in the last one.
+func calculateLinearGradient(width, height int, angle float64) (float64, float64, float64) {
+	radians := angle * math.Pi / 180
+	dx, dy := math.Cos(radians), math.Sin(radians)
+
+	// Round off the floating point noise of right angles
+	dx, dy = float64(roundFloat(dx*1e9))/1e9, float64(roundFloat(dy*1e9))/1e9
+
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, x := range []float64{0, float64(width - 1)} {
+		for _, y := range []float64{0, float64(height - 1)} {
+			p := x*dx + y*dy
+			min, max = math.Min(min, p), math.Max(max, p)
+		}
+	}
+
+	span := max - min
+	if span == 0 {
+		span = 1
+	}
+
+	return dx / span, dy / span, -min / span
+}
+
+// calculateRadialGradient returns the centre and the radius of a radial
+// gradient, in pixels.
+func calculateRadialGradient(width, height int, g Gradient) (float64, float64, float64) {
+	cx, cy := 0.5, 0.5
+	if g.Centre != nil {
+		cx, cy = g.Centre.X, g.Centre.Y
+	}
+	cx, cy = cx*float64(width-1), cy*float64(height-1)
+
+	radius := g.Radius
+	if radius == 0 {
+		for _, x := range []float64{0, float64(width - 1)} {
+			for _, y := range []float64{0, float64(height - 1)} {
+				radius = math.Max(radius, math.Hypot(x-cx, y-cy))
+			}
+		}
+	}
+	if radius == 0 {
+		radius = 1
+	}
+
+	return cx, cy, radius
+}
+
+// saveNewImage encodes an image created from scratch, as PNG unless another
+// type is given, with the same defaults as Resize. Images with alpha channel
+// are flattened onto white for JPEG.
+func saveNewImage(image *C.VipsImage, t ImageType, quality int) ([]byte, error) {
+	o := applyDefaults(Options{Type: t, Quality: quality}, PNG)
+
+	if !IsTypeSupportedSave(o.Type) {
+		C.g_object_unref(C.gpointer(image))
+		return nil, errors.New("Unsupported image output type")
+	}
+
+	if o.Type == JPEG {
+		flattened, err := vipsFlattenBackground(image, Color{255, 255, 255})
+		if err != nil {
+			C.g_object_unref(C.gpointer(image))
+			return nil, err
+		}
+		image = flattened
+	}
+
+	return saveImage(image, o)
+}
@@ -0,0 +1,143 @@
+package bimg
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewCanvas(t *testing.T) {
+	buf, err := NewCanvas(320, 240, ColorRGBA{255, 0, 0, 128}, PNG)
+	if err != nil {
+		t.Fatalf("Cannot create the canvas: %s", err)
+	}
+
+	if err := assertSize(buf, 320, 240); err != nil {
+		t.Error(err)
+	}
+
+	img, err := ToImage(buf, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, g, b, a := img.At(10, 10).RGBA()
+	if r>>8 != 128 || g != 0 || b != 0 || a>>8 != 128 {
+		t.Fatalf("Invalid canvas colour: %d, %d, %d, %d", r>>8, g>>8, b>>8, a>>8)
+	}
+
+	// A compressed single colour PNG is a tiny fraction of its raw size
+	if len(buf) > 320*240*4/10 {
+		t.Errorf("Expected a compressed image, got %d bytes", len(buf))
+	}
+
+	Write("testdata/test_canvas_out.png", buf)
+}
+
+func TestNewCanvasJpeg(t *testing.T) {
+	buf, err := NewCanvas(100, 50, ColorRGBA{0, 128, 255, 255}, JPEG)
+	if err != nil {
+		t.Fatalf("Cannot create the canvas: %s", err)
+	}
+
+	if DetermineImageType(buf) != JPEG {
+		t.Fatal("Image is not jpeg")
+	}
+	if err := assertSize(buf, 100, 50); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewCanvasInvalidSize(t *testing.T) {
+	if _, err := NewCanvas(0, 100, ColorRGBA{}, PNG); err == nil {
+		t.Fatal("Expected invalid size error")
+	}
+	if _, err := NewCanvas(maxSize+1, 100, ColorRGBA{}, PNG); err == nil {
+		t.Fatal("Expected maximum size error")
+	}
+}
+
+func TestNewGradient(t *testing.T) {
+	tests := []struct {
+		name     string
+		gradient Gradient
+	}{
+		{"linear", Gradient{Start: ColorRGBA{0, 0, 0, 255}, End: ColorRGBA{255, 255, 255, 255}}},
+		{"linear_vertical", Gradient{Start: ColorRGBA{0, 0, 0, 255}, End: ColorRGBA{255, 255, 255, 255}, Angle: 90}},
+		{"radial", Gradient{Type: GradientRadial, Start: ColorRGBA{0, 0, 0, 255}, End: ColorRGBA{255, 255, 255, 255}}},
+	}
+
+	for _, test := range tests {
+		buf, err := NewGradient(256, 128, test.gradient, PNG)
+		if err != nil {
+			t.Fatalf("Cannot create the %s gradient: %s", test.name, err)
+		}
+		if err := assertSize(buf, 256, 128); err != nil {
+			t.Error(err)
+		}
+
+		img, err := ToImage(buf, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var first, last uint32
+		switch test.name {
+		case "linear":
+			first, _, _, _ = img.At(0, 64).RGBA()
+			last, _, _, _ = img.At(255, 64).RGBA()
+		case "linear_vertical":
+			first, _, _, _ = img.At(128, 0).RGBA()
+			last, _, _, _ = img.At(128, 127).RGBA()
+		case "radial":
+			first, _, _, _ = img.At(128, 64).RGBA()
+			last, _, _, _ = img.At(0, 0).RGBA()
+		}
+		if first>>8 > 2 || last>>8 < 253 {
+			t.Errorf("Invalid %s gradient colours: %d, %d", test.name, first>>8, last>>8)
+		}
+
+		Write("testdata/test_gradient_"+test.name+"_out.png", buf)
+	}
+}
+
+func TestNewGradientInvalid(t *testing.T) {
+	if _, err := NewGradient(100, 100, Gradient{Type: GradientType(5)}, PNG); err == nil {
+		t.Fatal("Expected invalid gradient type error")
+	}
+	if _, err := NewGradient(100, 100, Gradient{Type: GradientRadial, Radius: -1}, PNG); err == nil {
+		t.Fatal("Expected invalid radius error")
+	}
+}
+
+func TestCalculateLinearGradient(t *testing.T) {
+	tests := []struct {
+		angle     float64
+		positions [4]float64 // top left, top right, bottom left, bottom right
+	}{
+		{0, [4]float64{0, 1, 0, 1}},
+		{90, [4]float64{0, 0, 1, 1}},
+		{180, [4]float64{1, 0, 1, 0}},
+		{45, [4]float64{0, 0.5, 0.5, 1}},
+	}
+
+	for _, test := range tests {
+		a, b, c := calculateLinearGradient(101, 101, test.angle)
+		for i, corner := range [][2]float64{{0, 0}, {100, 0}, {0, 100}, {100, 100}} {
+			p := corner[0]*a + corner[1]*b + c
+			if math.Abs(p-test.positions[i]) > 1e-6 {
+				t.Errorf("Invalid position for angle %f at %v: %f, expected %f", test.angle, corner, p, test.positions[i])
+			}
+		}
+	}
+}
+
+func TestCalculateRadialGradient(t *testing.T) {
+	cx, cy, r := calculateRadialGradient(101, 101, Gradient{})
+	if cx != 50 || cy != 50 || math.Abs(r-math.Hypot(50, 50)) > 1e-9 {
+		t.Fatalf("Invalid radial gradient: %f, %f, %f", cx, cy, r)
+	}
+
+	cx, cy, r = calculateRadialGradient(101, 201, Gradient{Centre: &Point{0, 1}, Radius: 20})
+	if cx != 0 || cy != 200 || r != 20 {
+		t.Fatalf("Invalid radial gradient: %f, %f, %f", cx, cy, r)
+	}
+}
@@ -0,0 +1,107 @@
+package bimg
+
+/*
+#cgo pkg-config: vips
+#include "vips/vips.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"runtime"
+)
+
+// DZLayout represents the tile pyramid layout written by DeepZoom.
+// See: https://libvips.github.io/libvips/API/current/VipsForeignSave.html#VipsForeignDzLayout
+type DZLayout int
+
+const (
+	// DZLayoutDZ uses the Microsoft Deep Zoom layout, as read by OpenSeadragon.
+	DZLayoutDZ DZLayout = iota
+	// DZLayoutZoomify uses the Zoomify layout.
+	DZLayoutZoomify
+	// DZLayoutGoogle uses the Google Maps layout.
+	DZLayoutGoogle
+	// DZLayoutIIIF uses the IIIF Image API v2 layout.
+	DZLayoutIIIF
+	// DZLayoutIIIF3 uses the IIIF Image API v3 layout (libvips 8.13+).
+	DZLayoutIIIF3
+)
+
+// DZDepth represents how deep the tile pyramid is built.
+type DZDepth int
+
+const (
+	// DZDepthOnePixel builds the pyramid down to a 1x1 pixel image.
+	DZDepthOnePixel DZDepth = C.VIPS_FOREIGN_DZ_DEPTH_ONEPIXEL
+	// DZDepthOneTile builds the pyramid down until the image fits in a single tile.
+	DZDepthOneTile DZDepth = C.VIPS_FOREIGN_DZ_DEPTH_ONETILE
+	// DZDepthOne writes the full resolution level only.
+	DZDepthOne DZDepth = C.VIPS_FOREIGN_DZ_DEPTH_ONE
+)
+
+// DZOptions represents the supported tile pyramid generation options.
+type DZOptions struct {
+	Layout   DZLayout
+	TileSize int
+	Overlap  int
+	Depth    DZDepth
+	// Type defines the tile image format. Valid values are JPEG, PNG and WEBP.
+	Type    ImageType
+	Quality int
+	// Path defines the output base name on disk (e.g. "/tiles/scan" writes
+	// scan.dzi and scan_files/). If empty, a zip archive buffer is returned.
+	Path string
+}
+
+var dzSuffixes = map[ImageType]string{
+	JPEG: ".jpg",
+	PNG:  ".png",
+	WEBP: ".webp",
+}
+
+// DeepZoom generates a tile pyramid of the given image buffer, as consumed
+// by viewers such as OpenSeadragon. Tiles are written to o.Path when defined,
+// otherwise the whole pyramid is returned as a zip archive buffer.
+func DeepZoom(buf []byte, o DZOptions) ([]byte, error) {
+	defer C.vips_thread_shutdown()
+	defer runtime.KeepAlive(buf)
+
+	o = applyDZDefaults(o)
+
+	if _, ok := dzSuffixes[o.Type]; !ok {
+		return nil, errors.New("Unsupported tile image type")
+	}
+	if _, ok := dzLayouts[o.Layout]; !ok {
+		return nil, errors.New("Invalid tile layout")
+	}
+	if o.Layout == DZLayoutIIIF3 && !(VipsMajorVersion > 8 || (VipsMajorVersion == 8 && VipsMinorVersion >= 13)) {
+		return nil, errors.New("IIIF3 layout requires libvips 8.13+")
+	}
+	if o.Path == "" && !(VipsMajorVersion > 8 || (VipsMajorVersion == 8 && VipsMinorVersion >= 8)) {
+		return nil, errors.New("Zip archive output requires libvips 8.8+")
+	}
+
+	image, _, err := loadImage(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return vipsDeepZoom(image, o)
+}
+
+func applyDZDefaults(o DZOptions) DZOptions {
+	if o.TileSize == 0 {
+		o.TileSize = 254
+		if o.Layout != DZLayoutDZ {
+			o.TileSize = 256
+		}
+	}
+	if o.Type == 0 {
+		o.Type = JPEG
+	}
+	if o.Quality == 0 {
+		o.Quality = Quality
+	}
+	return o
+}
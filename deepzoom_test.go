@@ -0,0 +1,69 @@
+package bimg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeepZoomZip(t *testing.T) {
+	if !(VipsMajorVersion >= 8 && VipsMinorVersion >= 8) {
+		t.Skipf("Skipping this test, libvips doesn't meet version requirement %s >= 8.8", VipsVersion)
+	}
+
+	buf, _ := Read("testdata/test.jpg")
+
+	zip, err := DeepZoom(buf, DZOptions{TileSize: 128, Overlap: 1})
+	if err != nil {
+		t.Fatalf("Cannot generate tile pyramid: %s", err)
+	}
+
+	if !bytes.HasPrefix(zip, []byte("PK")) {
+		t.Fatal("Output is not a zip archive")
+	}
+}
+
+func TestDeepZoomDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bimg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	buf, _ := Read("testdata/test.jpg")
+
+	out, err := DeepZoom(buf, DZOptions{Path: filepath.Join(dir, "test"), Type: PNG})
+	if err != nil {
+		t.Fatalf("Cannot generate tile pyramid: %s", err)
+	}
+	if out != nil {
+		t.Fatal("Expected no buffer when writing to disk")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "test.dzi")); err != nil {
+		t.Fatalf("Missing DZI descriptor: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "test_files", "0", "0_0.png")); err != nil {
+		t.Fatalf("Missing tile: %s", err)
+	}
+}
+
+func TestDeepZoomUnsupportedType(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+
+	_, err := DeepZoom(buf, DZOptions{Type: GIF})
+	if err == nil {
+		t.Fatal("Expected error for unsupported tile type")
+	}
+}
+
+func TestDeepZoomInvalidLayout(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+
+	_, err := DeepZoom(buf, DZOptions{Layout: DZLayout(42)})
+	if err == nil {
+		t.Fatal("Expected error for invalid tile layout")
+	}
+}
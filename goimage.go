@@ -0,0 +1,308 @@
+package bimg
+
+/*
+#cgo pkg-config: vips
+#include "vips/vips.h"
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"runtime"
+	"unsafe"
+)
+
+// nativeEndian is the host byte order, used by libvips for raw pixels.
+var nativeEndian binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 0 {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+// ToImage transforms the given image buffer with the passed options and
+// returns the result as a standard library image, skipping the encoding step.
+// Greyscale and 16-bit images keep their interpretation unless another one is
+// given, any other image is converted to sRGB. 8-bit results map to
+// *image.Gray, *image.RGBA or *image.NRGBA, and 16-bit results to
+// *image.Gray16, *image.RGBA64 or *image.NRGBA64.
+func ToImage(buf []byte, o Options) (image.Image, error) {
+	defer C.vips_thread_shutdown()
+	defer runtime.KeepAlive(buf)
+
+	image, imageType, err := loadImage(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return toImage(image, imageType, buf, o)
+}
+
+// ToImage processes the image based on the given transformation options
+// and returns the result as a standard library image.
+// The current image is not modified.
+func (i *Image) ToImage(o Options) (image.Image, error) {
+	if i.raw == nil {
+		return ToImage(i.buffer, o)
+	}
+
+	defer C.vips_thread_shutdown()
+
+	image, err := vipsReadRaw(*i.raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return toImage(image, UNKNOWN, nil, o)
+}
+
+// ImageConfig returns the size and the colour model of the standard library
+// image ToImage returns for the given buffer with only NoAutoRotate set.
+// The size is the stored one, so width and height are swapped compared to
+// ToImage without options for EXIF orientations 5 to 8.
+func ImageConfig(buf []byte) (image.Config, error) {
+	defer C.vips_thread_shutdown()
+
+	vipsImage, _, err := vipsRead(buf)
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer C.g_object_unref(C.gpointer(vipsImage))
+
+	interpretation := goImageInterpretation(vipsInterpretation(vipsImage), 0)
+
+	return image.Config{
+		ColorModel: goImageColorModel(interpretation, vipsHasAlpha(vipsImage)),
+		Width:      int(vipsImage.Xsize),
+		Height:     int(vipsImage.Ysize),
+	}, nil
+}
+
+// FromImage creates a new Image from a standard library image without
+// encoding it. *image.RGBA, *image.NRGBA, *image.Gray, *image.Gray16 and
+// *image.RGBA64 are copied directly, any other image is converted to NRGBA.
+func FromImage(img image.Image) (*Image, error) {
+	raw := imageToRaw(img)
+	if raw.Width <= 0 || raw.Height <= 0 {
+		return nil, errors.New("Image is empty")
+	}
+	return &Image{raw: &raw}, nil
+}
+
+func toImage(image *C.VipsImage, imageType ImageType, buf []byte, o Options) (image.Image, error) {
+	o.Interpretation = goImageInterpretation(vipsInterpretation(image), o.Interpretation)
+
+	// Colour spaces libvips cannot convert would be exported as is
+	if o.Interpretation != vipsInterpretation(image) && !vipsColourspaceIsSupported(image) {
+		C.g_object_unref(C.gpointer(image))
+		return nil, errors.New("Unsupported colour space for image.Image conversion")
+	}
+
+	raw, err := exportRaw(image, imageType, buf, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return rawToImage(raw)
+}
+
+// goImageInterpretation returns the interpretation to export an image with,
+// which is the requested one if the standard library can represent it, or
+// else the one of the image itself if it is greyscale or 16-bit, or else sRGB.
+func goImageInterpretation(in, requested Interpretation) Interpretation {
+	if requested == 0 {
+		requested = in
+	}
+
+	switch requested {
+	case InterpretationBW, InterpretationGREY16, InterpretationRGB16, InterpretationSRGB:
+		return requested
+	}
+	return InterpretationSRGB
+}
+
+// goImageColorModel returns the colour model of the images rawToImage
+// returns for the given interpretation.
+func goImageColorModel(interpretation Interpretation, alpha bool) color.Model {
+	switch interpretation {
+	case InterpretationBW:
+		if alpha {
+			return color.NRGBAModel
+		}
+		return color.GrayModel
+	case InterpretationGREY16:
+		if alpha {
+			return color.NRGBA64Model
+		}
+		return color.Gray16Model
+	case InterpretationRGB16:
+		if alpha {
+			return color.NRGBA64Model
+		}
+		return color.RGBA64Model
+	}
+
+	if alpha {
+		return color.NRGBAModel
+	}
+	return color.RGBAModel
+}
+
+func rawToImage(raw RawImage) (image.Image, error) {
+	rect := image.Rect(0, 0, raw.Width, raw.Height)
+	n := raw.Width * raw.Height
+
+	switch raw.Format {
+	case BandFormatUchar:
+		switch raw.Bands {
+		case 1:
+			img := image.NewGray(rect)
+			copy(img.Pix, raw.Pixels)
+			return img, nil
+		case 2:
+			img := image.NewNRGBA(rect)
+			for i := 0; i < n; i++ {
+				v, a := raw.Pixels[i*2], raw.Pixels[i*2+1]
+				img.Pix[i*4], img.Pix[i*4+1], img.Pix[i*4+2], img.Pix[i*4+3] = v, v, v, a
+			}
+			return img, nil
+		case 3:
+			img := image.NewRGBA(rect)
+			for i := 0; i < n; i++ {
+				copy(img.Pix[i*4:], raw.Pixels[i*3:i*3+3])
+				img.Pix[i*4+3] = 0xff
+			}
+			return img, nil
+		case 4:
+			img := image.NewNRGBA(rect)
+			copy(img.Pix, raw.Pixels)
+			return img, nil
+		}
+	case BandFormatUshort:
+		// Go stores 16-bit samples in big endian order
+		sample := func(dst []byte, i int) {
+			binary.BigEndian.PutUint16(dst, nativeEndian.Uint16(raw.Pixels[i*2:]))
+		}
+		switch raw.Bands {
+		case 1:
+			img := image.NewGray16(rect)
+			for i := 0; i < n; i++ {
+				sample(img.Pix[i*2:], i)
+			}
+			return img, nil
+		case 2:
+			img := image.NewNRGBA64(rect)
+			for i := 0; i < n; i++ {
+				for b := 0; b < 3; b++ {
+					sample(img.Pix[i*8+b*2:], i*2)
+				}
+				sample(img.Pix[i*8+6:], i*2+1)
+			}
+			return img, nil
+		case 3:
+			img := image.NewRGBA64(rect)
+			for i := 0; i < n; i++ {
+				for b := 0; b < 3; b++ {
+					sample(img.Pix[i*8+b*2:], i*3+b)
+				}
+				img.Pix[i*8+6], img.Pix[i*8+7] = 0xff, 0xff
+			}
+			return img, nil
+		case 4:
+			img := image.NewNRGBA64(rect)
+			for i := 0; i < n*4; i++ {
+				sample(img.Pix[i*2:], i)
+			}
+			return img, nil
+		}
+	}
+
+	return nil, errors.New("Unsupported pixel layout for image.Image conversion")
+}
+
+func imageToRaw(img image.Image) RawImage {
+	rect := img.Bounds()
+	raw := RawImage{Width: rect.Dx(), Height: rect.Dy()}
+
+	switch img := img.(type) {
+	case *image.Gray:
+		raw.Bands, raw.Format = 1, BandFormatUchar
+		raw.Pixels = copyRows(img.Pix, img.Stride, img.PixOffset(rect.Min.X, rect.Min.Y), raw.Width, raw.Height, 1)
+	case *image.Gray16:
+		raw.Bands, raw.Format = 1, BandFormatUshort
+		raw.Pixels = copyRows(img.Pix, img.Stride, img.PixOffset(rect.Min.X, rect.Min.Y), raw.Width, raw.Height, 2)
+		swapUint16(raw.Pixels)
+	case *image.NRGBA:
+		raw.Bands, raw.Format = 4, BandFormatUchar
+		raw.Pixels = copyRows(img.Pix, img.Stride, img.PixOffset(rect.Min.X, rect.Min.Y), raw.Width, raw.Height, 4)
+	case *image.RGBA:
+		raw.Bands, raw.Format = 4, BandFormatUchar
+		raw.Pixels = copyRows(img.Pix, img.Stride, img.PixOffset(rect.Min.X, rect.Min.Y), raw.Width, raw.Height, 4)
+		if !img.Opaque() {
+			unpremultiply8(raw.Pixels)
+		}
+	case *image.RGBA64:
+		raw.Bands, raw.Format = 4, BandFormatUshort
+		raw.Pixels = copyRows(img.Pix, img.Stride, img.PixOffset(rect.Min.X, rect.Min.Y), raw.Width, raw.Height, 8)
+		if !img.Opaque() {
+			unpremultiply16(raw.Pixels)
+		}
+		swapUint16(raw.Pixels)
+	default:
+		nrgba := image.NewNRGBA(image.Rect(0, 0, raw.Width, raw.Height))
+		draw.Draw(nrgba, nrgba.Bounds(), img, rect.Min, draw.Src)
+		raw.Bands, raw.Format = 4, BandFormatUchar
+		raw.Pixels = nrgba.Pix
+	}
+
+	return raw
+}
+
+// copyRows copies the visible rows of a standard library image
+// into a tightly packed pixel buffer.
+func copyRows(pix []byte, stride, offset, width, height, bpp int) []byte {
+	out := make([]byte, width*height*bpp)
+	for y := 0; y < height; y++ {
+		start := offset + y*stride
+		copy(out[y*width*bpp:], pix[start:start+width*bpp])
+	}
+	return out
+}
+
+// swapUint16 converts big endian 16-bit samples into host byte order, in place.
+func swapUint16(pix []byte) {
+	for i := 0; i+1 < len(pix); i += 2 {
+		nativeEndian.PutUint16(pix[i:], binary.BigEndian.Uint16(pix[i:]))
+	}
+}
+
+func unpremultiply8(pix []byte) {
+	for i := 0; i+3 < len(pix); i += 4 {
+		a := uint32(pix[i+3])
+		if a == 0 || a == 0xff {
+			continue
+		}
+		for b := 0; b < 3; b++ {
+			pix[i+b] = uint8(uint32(pix[i+b]) * 0xff / a)
+		}
+	}
+}
+
+func unpremultiply16(pix []byte) {
+	for i := 0; i+7 < len(pix); i += 8 {
+		a := uint32(binary.BigEndian.Uint16(pix[i+6:]))
+		if a == 0 || a == 0xffff {
+			continue
+		}
+		for b := 0; b < 6; b += 2 {
+			v := uint32(binary.BigEndian.Uint16(pix[i+b:]))
+			binary.BigEndian.PutUint16(pix[i+b:], uint16(v*0xffff/a))
+		}
+	}
+}
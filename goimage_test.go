@@ -0,0 +1,152 @@
+package bimg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestToImage(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+
+	img, err := ToImage(buf, Options{Width: 300, Height: 200, Crop: true})
+	if err != nil {
+		t.Fatalf("Cannot convert to image.Image: %s", err)
+	}
+
+	if _, ok := img.(*image.RGBA); !ok {
+		t.Fatalf("Invalid image type: %T", img)
+	}
+	if img.Bounds().Dx() != 300 || img.Bounds().Dy() != 200 {
+		t.Fatalf("Invalid image size: %dx%d", img.Bounds().Dx(), img.Bounds().Dy())
+	}
+}
+
+func TestToImageWithAlpha(t *testing.T) {
+	buf, _ := Read("testdata/transparent.png")
+
+	img, err := ToImage(buf, Options{Width: 100})
+	if err != nil {
+		t.Fatalf("Cannot convert to image.Image: %s", err)
+	}
+
+	if _, ok := img.(*image.NRGBA); !ok {
+		t.Fatalf("Invalid image type: %T", img)
+	}
+}
+
+func TestToImageGreyscale(t *testing.T) {
+	tests := []struct {
+		interpretation Interpretation
+		model          color.Model
+	}{
+		{InterpretationBW, color.GrayModel},
+		{InterpretationGREY16, color.Gray16Model},
+		{InterpretationRGB16, color.RGBA64Model},
+	}
+
+	for _, test := range tests {
+		buf, err := Resize(readImage("test.jpg"), Options{Width: 100, Type: PNG, Interpretation: test.interpretation})
+		if err != nil {
+			t.Fatalf("Cannot convert the image: %s", err)
+		}
+
+		img, err := ToImage(buf, Options{})
+		if err != nil {
+			t.Fatalf("Cannot convert to image.Image: %s", err)
+		}
+		if img.ColorModel() != test.model {
+			t.Errorf("Invalid colour model for interpretation %d: %T", test.interpretation, img)
+		}
+
+		config, err := ImageConfig(buf)
+		if err != nil {
+			t.Fatalf("Cannot read the image config: %s", err)
+		}
+		if config.ColorModel != img.ColorModel() {
+			t.Errorf("Colour model mismatch for interpretation %d", test.interpretation)
+		}
+	}
+}
+
+func TestToImageCMYK(t *testing.T) {
+	buf, err := Resize(readImage("test.jpg"), Options{Width: 100, Interpretation: InterpretationCMYK})
+	if err != nil {
+		t.Fatalf("Cannot convert the image: %s", err)
+	}
+	if interpretation, _ := ImageInterpretation(buf); interpretation != InterpretationCMYK {
+		t.Skip("Skipping this test, libvips cannot convert to CMYK")
+	}
+
+	img, err := ToImage(buf, Options{})
+	if err != nil {
+		t.Fatalf("Cannot convert to image.Image: %s", err)
+	}
+	if _, ok := img.(*image.RGBA); !ok {
+		t.Fatalf("Invalid image type: %T", img)
+	}
+
+	// Pure CMYK values would give a saturated colour once read as RGB
+	r, g, b, _ := img.At(50, 30).RGBA()
+	original, _ := ToImage(readImage("test.jpg"), Options{Width: 100})
+	or, og, ob, _ := original.At(50, 30).RGBA()
+	if absDiff(r, or) > 0x2000 || absDiff(g, og) > 0x2000 || absDiff(b, ob) > 0x2000 {
+		t.Fatalf("Invalid CMYK conversion: %d,%d,%d instead of %d,%d,%d", r, g, b, or, og, ob)
+	}
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func TestFromImage(t *testing.T) {
+	tests := []image.Image{
+		image.NewRGBA(image.Rect(0, 0, 200, 100)),
+		image.NewNRGBA(image.Rect(0, 0, 200, 100)),
+		image.NewGray(image.Rect(0, 0, 200, 100)),
+		image.NewGray16(image.Rect(0, 0, 200, 100)),
+		image.NewRGBA64(image.Rect(0, 0, 200, 100)),
+		image.NewYCbCr(image.Rect(0, 0, 200, 100), image.YCbCrSubsampleRatio420),
+	}
+
+	for _, src := range tests {
+		img, err := FromImage(src)
+		if err != nil {
+			t.Fatalf("Cannot create image from %T: %s", src, err)
+		}
+
+		buf, err := img.Process(Options{Width: 100, Type: JPEG})
+		if err != nil {
+			t.Fatalf("Cannot process %T: %s", src, err)
+		}
+
+		if DetermineImageType(buf) != JPEG {
+			t.Fatal("Image is not jpeg")
+		}
+		if err := assertSize(buf, 100, 50); err != nil {
+			t.Errorf("%T: %s", src, err)
+		}
+	}
+}
+
+func TestFromImageRoundTrip(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	src.Set(1, 2, color.NRGBA{10, 20, 30, 40})
+
+	img, err := FromImage(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := img.ToImage(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.At(1, 2) != src.At(1, 2) {
+		t.Fatalf("Invalid pixel value: %v", out.At(1, 2))
+	}
+}
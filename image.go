@@ -3,11 +3,12 @@ package bimg
 // Image provides a simple method DSL to transform a given image as byte buffer.
 type Image struct {
 	buffer []byte
+	raw    *RawImage
 }
 
 // NewImage creates a new Image struct with method DSL.
 func NewImage(buf []byte) *Image {
-	return &Image{buf}
+	return &Image{buffer: buf}
 }
 
 // Resize resizes the image to fixed width and height.
@@ -200,42 +201,75 @@ func (i *Image) Gamma(exponent float64) ([]byte, error) {
 // talking with libvips bindings accordingly and returning the resultant
 // image buffer.
 func (i *Image) Process(o Options) ([]byte, error) {
-	image, err := Resize(i.buffer, o)
+	var image []byte
+	var err error
+	if i.raw != nil {
+		image, err = resizerRaw(*i.raw, o)
+	} else {
+		image, err = Resize(i.buffer, o)
+	}
 	if err != nil {
 		return nil, err
 	}
 	i.buffer = image
+	i.raw = nil
 	return image, nil
 }
 
+// ExportRaw processes the image based on the given transformation options
+// and returns the resultant decoded pixels. The current image is not modified.
+func (i *Image) ExportRaw(o Options) (RawImage, error) {
+	if i.raw != nil {
+		return exportRawFromRaw(*i.raw, o)
+	}
+	return ExportRaw(i.buffer, o)
+}
+
 // Metadata returns the image metadata (size, alpha channel, profile, EXIF rotation).
 func (i *Image) Metadata() (ImageMetadata, error) {
+	if i.raw != nil {
+		return rawMetadata(*i.raw)
+	}
 	return Metadata(i.buffer)
 }
 
 // Interpretation gets the image interpretation type.
 // See: https://libvips.github.io/libvips/API/current/VipsImage.html#VipsInterpretation
 func (i *Image) Interpretation() (Interpretation, error) {
+	if i.raw != nil {
+		return rawInterpretation(*i.raw)
+	}
 	return ImageInterpretation(i.buffer)
 }
 
 // ColourspaceIsSupported checks if the current image
 // color space is supported.
 func (i *Image) ColourspaceIsSupported() (bool, error) {
+	if i.raw != nil {
+		return rawColourspaceIsSupported(*i.raw)
+	}
 	return ColourspaceIsSupported(i.buffer)
 }
 
 // Type returns the image type format (jpeg, png, webp, tiff).
+// Images created from raw pixels have no type until processed.
 func (i *Image) Type() string {
+	if i.raw != nil {
+		return ImageTypeName(UNKNOWN)
+	}
 	return DetermineImageTypeName(i.buffer)
 }
 
 // Size returns the image size as form of width and height pixels.
 func (i *Image) Size() (ImageSize, error) {
+	if i.raw != nil {
+		return ImageSize{Width: i.raw.Width, Height: i.raw.Height}, nil
+	}
 	return Size(i.buffer)
 }
 
-// Image returns the current resultant image buffer.
+// Image returns the current resultant image buffer, which is empty
+// for images created from raw pixels until processed.
 func (i *Image) Image() []byte {
 	return i.buffer
 }
@@ -278,6 +278,81 @@ func TestImageWatermarkWithImage(t *testing.T) {
 	Write("testdata/test_watermark_image_out.jpg", buf)
 }
 
+func TestImageWatermarkImageScaleAndGravity(t *testing.T) {
+	block, err := RenderText(TextOptions{Text: "W", Background: &ColorRGBA{255, 0, 0, 255}, Padding: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	southEast, centre := GravitySouthEast, GravityCentre
+	tests := []WatermarkImage{
+		{Buf: block, Scale: 0.1, Gravity: &southEast, Margin: 20},
+		{Buf: block, Scale: 0.1, Tile: true, Spacing: 30, Opacity: 0.5},
+		{Buf: block, Scale: 0.2, Angle: 30, Gravity: &centre},
+	}
+
+	for i, watermark := range tests {
+		image := initImage("test.jpg")
+		_, err := image.Crop(800, 600, GravityNorth)
+		if err != nil {
+			t.Errorf("Cannot process the image: %s", err)
+		}
+
+		buf, err := image.WatermarkImage(watermark)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = assertSize(buf, 800, 600)
+		if err != nil {
+			t.Error(err)
+		}
+
+		Write(fmt.Sprintf("testdata/test_watermark_image_%d_out.jpg", i), buf)
+	}
+}
+
+func TestWatermarkImagePlacement(t *testing.T) {
+	block, err := RenderText(TextOptions{Text: "W", Background: &ColorRGBA{255, 0, 0, 255}, Padding: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, _ := imageBuf("test.png")
+	southEast, centre := GravitySouthEast, GravityCentre
+	img, err := ToImage(buf, Options{
+		Type:           PNG,
+		WatermarkImage: WatermarkImage{Buf: block, Opacity: 1, Scale: 0.2, Gravity: &southEast, Margin: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The watermark is 80px wide, 10px away from the bottom right corner
+	isRed := func(x, y int) bool {
+		r, g, b, _ := img.At(x, y).RGBA()
+		return r>>8 > 240 && g>>8 < 16 && b>>8 < 16
+	}
+	if !isRed(388, 288) || !isRed(312, 288) {
+		t.Fatal("Expected the watermark in the bottom right corner")
+	}
+	if isRed(395, 295) || isRed(305, 288) {
+		t.Fatal("Expected the watermark to keep its margin")
+	}
+
+	// GravityCentre centres the watermark, unlike the default position
+	img, err = ToImage(buf, Options{
+		Type:           PNG,
+		WatermarkImage: WatermarkImage{Buf: block, Opacity: 1, Scale: 0.2, Gravity: &centre},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isRed(165, 150) || !isRed(235, 150) || isRed(155, 150) {
+		t.Fatal("Expected the watermark in the centre")
+	}
+}
+
 func TestImageWatermarkNoReplicate(t *testing.T) {
 	image := initImage("test.jpg")
 	_, err := image.Crop(800, 600, GravityNorth)
@@ -309,6 +384,102 @@ func TestImageWatermarkNoReplicate(t *testing.T) {
 	Write("testdata/test_watermark_replicate_out.jpg", buf)
 }
 
+func TestImageWatermarkTextLayer(t *testing.T) {
+	if !(VipsMajorVersion >= 8 && VipsMinorVersion >= 6) {
+		t.Skipf("Skipping this test, libvips doesn't meet version requirement %s >= 8.6", VipsVersion)
+	}
+
+	tests := []Watermark{
+		{
+			Text:        "Copy me if you can",
+			Width:       200,
+			DPI:         100,
+			NoReplicate: true,
+			Color:       &ColorRGBA{255, 255, 255, 200},
+			BoxColor:    &ColorRGBA{0, 0, 0, 128},
+			BoxPadding:  10,
+			Gravity:     GravitySouthEast,
+			Left:        -20,
+			Top:         -20,
+		},
+		{
+			Text:    "Draft",
+			DPI:     150,
+			Color:   &ColorRGBA{255, 0, 0, 96},
+			Angle:   -45,
+			Spacing: 40,
+		},
+		{
+			Text:        "<b>Bold</b> & <span foreground=\"red\">red</span>\nsecond line",
+			Markup:      true,
+			Align:       TextAlignCentre,
+			NoReplicate: true,
+			Color:       &ColorRGBA{255, 255, 255, 255},
+		},
+		{
+			Text:        "Fish & <chips>",
+			NoReplicate: true,
+			Color:       &ColorRGBA{0, 0, 0, 255},
+		},
+	}
+
+	for _, watermark := range tests {
+		image := initImage("test.jpg")
+		_, err := image.Crop(800, 600, GravityNorth)
+		if err != nil {
+			t.Errorf("Cannot process the image: %s", err)
+		}
+
+		buf, err := image.Watermark(watermark)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = assertSize(buf, 800, 600)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if DetermineImageType(buf) != JPEG {
+			t.Fatal("Image is not jpeg")
+		}
+	}
+}
+
+func TestWatermarkTextLayerPlacement(t *testing.T) {
+	if !(VipsMajorVersion >= 8 && VipsMinorVersion >= 6) {
+		t.Skipf("Skipping this test, libvips doesn't meet version requirement %s >= 8.6", VipsVersion)
+	}
+
+	buf, _ := imageBuf("test.png")
+	original, err := ToImage(buf, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := ToImage(buf, Options{
+		Watermark: Watermark{
+			Text:        "bimg",
+			NoReplicate: true,
+			Color:       &ColorRGBA{0, 0, 0, 255},
+			BoxColor:    &ColorRGBA{255, 0, 0, 255},
+			BoxPadding:  20,
+			Gravity:     GravitySouthEast,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bounds := img.Bounds()
+	if r, g, b, _ := img.At(bounds.Dx()-5, bounds.Dy()-5).RGBA(); r != 0xffff || g != 0 || b != 0 {
+		t.Errorf("Expected the box in the bottom-right corner, got %d,%d,%d", r, g, b)
+	}
+	if img.At(0, 0) != original.At(0, 0) {
+		t.Error("Expected the top-left corner to be unchanged")
+	}
+}
+
 func TestImageZoom(t *testing.T) {
 	image := initImage("test.jpg")
 
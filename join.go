@@ -0,0 +1,93 @@
+package bimg
+
+/*
+#cgo pkg-config: vips
+#include "vips/vips.h"
+*/
+import "C"
+
+import (
+	"errors"
+)
+
+// JoinImages joins the given image buffers into a single image, such as a
+// grid, a strip or a contact sheet, filling the rows from left to right.
+func JoinImages(bufs [][]byte, o JoinOptions) ([]byte, error) {
+	defer C.vips_thread_shutdown()
+
+	if len(bufs) == 0 {
+		return nil, errors.New("No images to join")
+	}
+	if o.Across < 0 || o.Spacing < 0 || o.CellWidth < 0 || o.CellHeight < 0 {
+		return nil, errors.New("Join options cannot be negative")
+	}
+	if !(VipsMajorVersion > 8 || (VipsMajorVersion == 8 && VipsMinorVersion >= 6)) {
+		return nil, errors.New("Joining images requires libvips 8.6+")
+	}
+
+	// Defaults
+	if o.Across == 0 || o.Across > len(bufs) {
+		o.Across = len(bufs)
+	}
+	if o.Fit == 0 {
+		o.Fit = FitInside
+	}
+	if o.Quality == 0 {
+		o.Quality = Quality
+	}
+
+	images := make([]*C.VipsImage, 0, len(bufs))
+	release := func() {
+		for _, image := range images {
+			C.g_object_unref(C.gpointer(image))
+		}
+	}
+
+	cellWidth, cellHeight := o.CellWidth, o.CellHeight
+	alpha := o.Background.A < 255
+	for _, buf := range bufs {
+		image, err := joinCell(buf, o)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		images = append(images, image)
+
+		if int(image.Xsize) > cellWidth {
+			cellWidth = int(image.Xsize)
+		}
+		if int(image.Ysize) > cellHeight {
+			cellHeight = int(image.Ysize)
+		}
+		alpha = alpha || vipsHasAlpha(image)
+	}
+
+	rows := (len(images) + o.Across - 1) / o.Across
+	if o.Across*cellWidth+(o.Across-1)*o.Spacing > maxSize || rows*cellHeight+(rows-1)*o.Spacing > maxSize {
+		release()
+		return nil, errors.New("Maximum image size exceeded")
+	}
+
+	image, err := vipsArrayJoin(images, o.Across, o.Spacing, cellWidth, cellHeight, o.HAlign, o.VAlign, o.Background, alpha)
+	if err != nil {
+		return nil, err
+	}
+
+	return saveNewImage(image, o.Type, o.Quality)
+}
+
+// joinCell loads an image to join, auto-rotated and resized to the cell.
+func joinCell(buf []byte, o JoinOptions) (*C.VipsImage, error) {
+	image, imageType, err := loadImage(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	cell := Options{Gravity: o.Gravity}
+	if o.CellWidth > 0 || o.CellHeight > 0 {
+		cell.Width, cell.Height, cell.Fit = o.CellWidth, o.CellHeight, o.Fit
+		cell.CanvasBackground = &o.Background
+	}
+
+	return processImage(image, imageType, buf, applyDefaults(cell, imageType))
+}
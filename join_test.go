@@ -0,0 +1,89 @@
+package bimg
+
+import (
+	"testing"
+)
+
+func TestJoinImages(t *testing.T) {
+	bufs := [][]byte{
+		readFile("test.jpg"),
+		readFile("test.png"),
+		readFile("transparent.png"),
+	}
+
+	buf, err := JoinImages(bufs, JoinOptions{
+		Across:     2,
+		Spacing:    10,
+		CellWidth:  200,
+		CellHeight: 150,
+		HAlign:     AlignCentre,
+		VAlign:     AlignCentre,
+		Background: ColorRGBA{255, 255, 255, 255},
+		Type:       JPEG,
+	})
+	if err != nil {
+		t.Fatalf("Cannot join the images: %s", err)
+	}
+
+	if DetermineImageType(buf) != JPEG {
+		t.Fatal("Image is not jpeg")
+	}
+	if err := assertSize(buf, 410, 310); err != nil {
+		t.Error(err)
+	}
+
+	Write("testdata/test_join_out.jpg", buf)
+}
+
+func TestJoinImagesStrip(t *testing.T) {
+	bufs := [][]byte{readFile("test.png"), readFile("transparent.png")}
+
+	buf, err := JoinImages(bufs, JoinOptions{})
+	if err != nil {
+		t.Fatalf("Cannot join the images: %s", err)
+	}
+
+	if DetermineImageType(buf) != PNG {
+		t.Fatal("Image is not png")
+	}
+	// Cells are as large as the largest image
+	if err := assertSize(buf, 800, 300); err != nil {
+		t.Error(err)
+	}
+
+	meta, _ := Metadata(buf)
+	if !meta.Alpha {
+		t.Fatal("Expected a transparent background")
+	}
+}
+
+func TestJoinImagesCover(t *testing.T) {
+	bufs := [][]byte{readFile("test.jpg"), readFile("northern_cardinal_bird.jpg"), readFile("test_square.jpg")}
+
+	buf, err := JoinImages(bufs, JoinOptions{Across: 1, CellWidth: 100, CellHeight: 100, Fit: FitCover})
+	if err != nil {
+		t.Fatalf("Cannot join the images: %s", err)
+	}
+
+	if err := assertSize(buf, 100, 300); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestJoinImagesInvalid(t *testing.T) {
+	tests := []struct {
+		bufs [][]byte
+		o    JoinOptions
+	}{
+		{nil, JoinOptions{}},
+		{[][]byte{readFile("test.png")}, JoinOptions{Spacing: -1}},
+		{[][]byte{readFile("test.png"), []byte("invalid")}, JoinOptions{}},
+		{[][]byte{readFile("test.png")}, JoinOptions{HAlign: Align(5)}},
+	}
+
+	for _, test := range tests {
+		if _, err := JoinImages(test.bufs, test.o); err == nil {
+			t.Errorf("Expected error for %#v", test.o)
+		}
+	}
+}
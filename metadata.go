@@ -169,6 +169,10 @@ func Metadata(buf []byte) (ImageMetadata, error) {
 	}
 	defer C.g_object_unref(C.gpointer(image))
 
+	return imageMetadata(image, imageType), nil
+}
+
+func imageMetadata(image *C.VipsImage, imageType ImageType) ImageMetadata {
 	size := ImageSize{
 		Width:  int(image.Xsize),
 		Height: int(image.Ysize),
@@ -239,5 +243,5 @@ func Metadata(buf []byte) (ImageMetadata, error) {
 		},
 	}
 
-	return metadata, nil
+	return metadata
 }
@@ -5,7 +5,12 @@ package bimg
 #include "vips/vips.h"
 */
 import "C"
-import "errors"
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
 
 const (
 	// Quality defines the default JPEG quality to be used.
@@ -47,6 +52,181 @@ const (
 	GravityWest
 	// GravitySmart enables libvips Smart Crop algorithm for image gravity orientation.
 	GravitySmart
+	// GravityNorthEast represents the top-right corner used for image gravity orientation.
+	GravityNorthEast
+	// GravityNorthWest represents the top-left corner used for image gravity orientation.
+	GravityNorthWest
+	// GravitySouthEast represents the bottom-right corner used for image gravity orientation.
+	GravitySouthEast
+	// GravitySouthWest represents the bottom-left corner used for image gravity orientation.
+	GravitySouthWest
+)
+
+// SmartCropStrategy represents the libvips strategy used by smart crop
+// to find the interesting area of an image.
+type SmartCropStrategy int
+
+const (
+	// SmartCropAttention looks for features likely to draw human attention,
+	// such as skin tones, saturated colours and edges. This is the default.
+	SmartCropAttention SmartCropStrategy = iota
+	// SmartCropEntropy keeps the area with the highest entropy.
+	SmartCropEntropy
+	// SmartCropCentre keeps the centre of the image.
+	SmartCropCentre
+	// SmartCropLow keeps the area with the lowest coordinates (top-left).
+	SmartCropLow
+	// SmartCropHigh keeps the area with the highest coordinates (bottom-right).
+	SmartCropHigh
+)
+
+// Rect represents a rectangular area of an image, in pixels.
+type Rect struct {
+	Left   int
+	Top    int
+	Width  int
+	Height int
+}
+
+// BlendMode represents the mode used to composite a layer over an image.
+// See: https://libvips.github.io/libvips/API/current/libvips-conversion.html#VipsBlendMode
+type BlendMode int
+
+const (
+	// BlendOver places the layer over the image. This is the default.
+	BlendOver BlendMode = iota
+	// BlendMultiply multiplies the colours, darkening the image.
+	BlendMultiply
+	// BlendScreen multiplies the complements of the colours, lightening the image.
+	BlendScreen
+	// BlendOverlay multiplies or screens the colours, depending on the image.
+	BlendOverlay
+	// BlendDarken keeps the darkest colour of each channel.
+	BlendDarken
+	// BlendLighten keeps the lightest colour of each channel.
+	BlendLighten
+	// BlendColourDodge brightens the image to reflect the layer.
+	BlendColourDodge
+	// BlendColourBurn darkens the image to reflect the layer.
+	BlendColourBurn
+	// BlendHardLight multiplies or screens the colours, depending on the layer.
+	BlendHardLight
+	// BlendSoftLight darkens or lightens the colours, depending on the layer.
+	BlendSoftLight
+	// BlendDifference subtracts the darker of the two colours from the lighter one.
+	BlendDifference
+	// BlendExclusion is similar to BlendDifference, but with lower contrast.
+	BlendExclusion
+	// BlendAdd adds the layer to the image.
+	BlendAdd
+	// BlendIn keeps the layer only where the image is opaque.
+	BlendIn
+	// BlendAtop places the layer over the image, only where the image is opaque.
+	BlendAtop
+	// BlendDestOver places the layer below the image.
+	BlendDestOver
+	// BlendXor keeps both the image and the layer, except where they overlap.
+	BlendXor
+)
+
+// Layer represents an image composited over the transformed image.
+type Layer struct {
+	// Buf is the image buffer of the layer.
+	Buf []byte
+	// Left and Top place the layer, in pixels, if Absolute is set. The layer
+	// is otherwise placed according to Gravity. With Tile, they offset the tiles.
+	Left     int
+	Top      int
+	Absolute bool
+	Gravity  Gravity
+	// Tile repeats the layer over the whole image.
+	Tile bool
+	// Opacity scales the layer alpha, from 0 to 1 (default).
+	Opacity float32
+	Blend   BlendMode
+}
+
+// Point represents a position within an image, in pixels.
+type Point struct {
+	X float64
+	Y float64
+}
+
+// Perspective represents a four point perspective warp, which maps the
+// quadrilateral defined by Corners (top-left, top-right, bottom-right and
+// bottom-left, in source pixels) onto a Width x Height rectangle.
+// If Width or Height are zero, they are inferred from the longest
+// opposite edges of the quadrilateral.
+type Perspective struct {
+	Corners [4]Point
+	Width   int
+	Height  int
+}
+
+// Padding represents the space, in pixels, added to each side of an image.
+type Padding struct {
+	Top    int
+	Right  int
+	Bottom int
+	Left   int
+}
+
+// AspectRatio represents the ratio between the width and height of an image,
+// such as 16.0 / 9.
+type AspectRatio float64
+
+// ParseAspectRatio parses an aspect ratio in "width:height" notation,
+// such as "16:9", or as a decimal number, such as "1.5".
+func ParseAspectRatio(s string) (AspectRatio, error) {
+	var ratio float64
+	var err error
+
+	if parts := strings.SplitN(s, ":", 2); len(parts) == 2 {
+		var w, h float64
+		w, err = strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		if err == nil {
+			h, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		}
+		if err == nil && h != 0 {
+			ratio = w / h
+		}
+	} else {
+		ratio, err = strconv.ParseFloat(strings.TrimSpace(s), 64)
+	}
+
+	if err != nil || ratio <= 0 || math.IsInf(ratio, 0) || math.IsNaN(ratio) {
+		return 0, errors.New("Invalid aspect ratio: " + s)
+	}
+	return AspectRatio(ratio), nil
+}
+
+// FocalPoint represents the subject of an image in relative coordinates,
+// from 0,0 (top-left corner) to 1,1 (bottom-right corner).
+type FocalPoint struct {
+	X float64
+	Y float64
+}
+
+// Fit represents how the image is resized to the requested width and height,
+// equivalent to the CSS object-fit property. The zero value keeps the
+// behaviour inferred from the Crop, Embed and Force options.
+type Fit int
+
+const (
+	// FitCover preserves the aspect ratio, scaling the image to cover both
+	// dimensions and cropping the overflow according to Gravity.
+	FitCover Fit = iota + 1
+	// FitContain preserves the aspect ratio, scaling the image to fit within
+	// both dimensions and embedding it on the Extend/Background canvas.
+	FitContain
+	// FitFill ignores the aspect ratio, stretching the image to both dimensions.
+	FitFill
+	// FitInside preserves the aspect ratio, scaling the image as large as
+	// possible while fitting within both dimensions. No crop or embed is done.
+	FitInside
+	// FitOutside preserves the aspect ratio, scaling the image as small as
+	// possible while covering both dimensions. No crop or embed is done.
+	FitOutside
 )
 
 // Interpolator represents the image interpolation value.
@@ -106,18 +286,26 @@ const (
 	// D0 represents the rotation angle 0 degrees.
 	D0 Angle = 0
 	// D45 represents the rotation angle 45 degrees.
+	//
+	// Deprecated: Rotate only supports right angles, use Options.RotateDegrees instead.
 	D45 Angle = 45
 	// D90 represents the rotation angle 90 degrees.
 	D90 Angle = 90
 	// D135 represents the rotation angle 135 degrees.
+	//
+	// Deprecated: Rotate only supports right angles, use Options.RotateDegrees instead.
 	D135 Angle = 135
 	// D180 represents the rotation angle 180 degrees.
 	D180 Angle = 180
 	// D235 represents the rotation angle 235 degrees.
+	//
+	// Deprecated: Rotate only supports right angles, use Options.RotateDegrees instead.
 	D235 Angle = 235
 	// D270 represents the rotation angle 270 degrees.
 	D270 Angle = 270
 	// D315 represents the rotation angle 315 degrees.
+	//
+	// Deprecated: Rotate only supports right angles, use Options.RotateDegrees instead.
 	D315 Angle = 315
 )
 
@@ -185,6 +373,9 @@ const (
 // WatermarkFont defines the default watermark font to be used.
 var WatermarkFont = "sans 10"
 
+// watermarkDPI defines the default text watermark resolution.
+const watermarkDPI = 150
+
 // Color represents a traditional RGB color scheme.
 type Color struct {
 	R, G, B uint8
@@ -193,6 +384,152 @@ type Color struct {
 // ColorBlack is a shortcut to black RGB color representation.
 var ColorBlack = Color{0, 0, 0}
 
+// ColorRGBA represents a RGB color scheme with an alpha channel,
+// where A=0 is fully transparent and A=255 is fully opaque.
+type ColorRGBA struct {
+	R, G, B, A uint8
+}
+
+// Align represents the alignment of an image within a larger cell.
+type Align int
+
+const (
+	// AlignLow aligns the image on the left or on the top. This is the default.
+	AlignLow Align = iota
+	// AlignCentre centres the image.
+	AlignCentre
+	// AlignHigh aligns the image on the right or on the bottom.
+	AlignHigh
+)
+
+// JoinOptions represents the options used to join images into a grid.
+type JoinOptions struct {
+	// Across is the number of images per row. Defaults to a single row.
+	Across int
+	// Spacing is the space between images, in pixels.
+	Spacing int
+	// Background fills the spacing and the uncovered part of the cells.
+	// Defaults to transparent.
+	Background ColorRGBA
+	// HAlign and VAlign align the images within their cells.
+	HAlign Align
+	VAlign Align
+	// CellWidth and CellHeight resize every image to the cell size with
+	// Fit, FitInside by default, and Gravity. Cells are otherwise as large
+	// as the largest image.
+	CellWidth  int
+	CellHeight int
+	Fit        Fit
+	Gravity    Gravity
+	// Type is the output image type, PNG by default.
+	Type    ImageType
+	Quality int
+}
+
+// SpritePacking represents the algorithm used to pack images into a sprite sheet.
+type SpritePacking int
+
+const (
+	// SpritePackingShelf places the images in rows, tallest first. This is the default.
+	SpritePackingShelf SpritePacking = iota
+	// SpritePackingMaxRects places each image in the free area closest to
+	// the top left corner, producing denser sheets for images of mixed sizes.
+	SpritePackingMaxRects
+)
+
+// SpriteOptions represents the options used to build a sprite sheet.
+type SpriteOptions struct {
+	Packing SpritePacking
+	// MaxWidth is the maximum width of the sheet. Defaults to the width
+	// of a square sheet, or to the widest image if wider.
+	MaxWidth int
+	// Spacing is the space between images, in pixels.
+	Spacing int
+	// Background fills the sheet around the images, which are copied as they
+	// are on a transparent sheet and flattened onto it otherwise.
+	// Defaults to transparent.
+	Background ColorRGBA
+	// Type is the output image type, PNG by default.
+	Type    ImageType
+	Quality int
+}
+
+// GradientType represents the shape of a colour gradient.
+type GradientType int
+
+const (
+	// GradientLinear blends the colours along a straight line. This is the default.
+	GradientLinear GradientType = iota
+	// GradientRadial blends the colours outwards from a centre point.
+	GradientRadial
+)
+
+// Gradient represents the options of a colour gradient.
+type Gradient struct {
+	Type GradientType
+	// Start and End are the colours at either end of the gradient.
+	Start ColorRGBA
+	End   ColorRGBA
+	// Angle is the direction of linear gradients, in degrees clockwise,
+	// where 0 goes from left to right.
+	Angle float64
+	// Centre is the centre of radial gradients, relative to the image
+	// size from 0 to 1. Defaults to the centre of the image.
+	Centre *Point
+	// Radius is the radius of radial gradients, in pixels. Defaults to
+	// the distance to the farthest corner.
+	Radius float64
+}
+
+// TextAlign represents the alignment of multi-line text.
+type TextAlign int
+
+const (
+	// TextAlignLeft aligns the lines on the left. This is the default.
+	TextAlignLeft TextAlign = iota
+	// TextAlignCentre centres the lines.
+	TextAlignCentre
+	// TextAlignRight aligns the lines on the right.
+	TextAlignRight
+)
+
+// TextOptions represents the text rendering options.
+type TextOptions struct {
+	// Text is rendered verbatim, unless Markup is set.
+	Text string
+	// Font is a Pango font description, such as "sans 12". When a font
+	// file is used, it must name the family of that font.
+	Font string
+	// FontFile is the path to a TrueType or OpenType font file.
+	FontFile string
+	// FontData is the content of a font file, used instead of FontFile.
+	// It is written to a temporary directory, which Shutdown removes.
+	FontData []byte
+	// Markup parses Text as Pango markup, allowing bold or coloured spans.
+	Markup bool
+	// Width wraps the text at the given width, in pixels.
+	Width int
+	// Height, along with Width, fits the text in the given box, using
+	// the largest DPI that fits instead of DPI. Requires libvips 8.12+.
+	Height int
+	// DPI sets the text resolution, the libvips default when zero.
+	DPI     int
+	Align   TextAlign
+	Justify bool
+	// The options below are only used by RenderText.
+	// Color is the text colour, opaque black by default.
+	Color *ColorRGBA
+	// Background, if defined, fills the image behind the text.
+	// Otherwise, the image is transparent.
+	Background *ColorRGBA
+	// Padding is the space around the text, in pixels.
+	Padding int
+	// Type is the output image type, PNG by default. The image is
+	// flattened onto white for types without alpha channel.
+	Type    ImageType
+	Quality int
+}
+
 // Watermark represents the text-based watermark supported options.
 type Watermark struct {
 	Width       int
@@ -203,6 +540,35 @@ type Watermark struct {
 	Text        string
 	Font        string
 	Background  Color
+	// Color, if defined, is the text colour including its alpha, and
+	// enables the options below. Otherwise, Background is used as text
+	// colour and the text is placed at a fixed offset.
+	Color *ColorRGBA
+	// BoxColor, if defined, draws a box behind the text, extending
+	// BoxPadding pixels around it.
+	BoxColor   *ColorRGBA
+	BoxPadding int
+	// Gravity places the text when NoReplicate is set, Margin pixels away
+	// from the given edges and offset by Left and Top, as WatermarkImage
+	// does. When tiling, Left and Top offset the tiles instead.
+	Gravity Gravity
+	Left    int
+	Top     int
+	// Angle rotates the text clockwise, in degrees.
+	Angle float64
+	// Spacing is the space between tiles, in pixels. Defaults to Margin,
+	// or Width when there is no margin.
+	Spacing int
+	// FontFile and FontData load the font from a file or from memory,
+	// see TextOptions. Font must then name the family of that font.
+	FontFile string
+	FontData []byte
+	// Markup parses Text as Pango markup, including coloured spans on
+	// libvips 8.12+. Without it, Text is rendered verbatim when Color is
+	// defined, and is always parsed as markup otherwise.
+	Markup  bool
+	Align   TextAlign
+	Justify bool
 }
 
 // WatermarkImage represents the image-based watermark supported options.
@@ -211,6 +577,61 @@ type WatermarkImage struct {
 	Top     int
 	Buf     []byte
 	Opacity float32
+	// Scale resizes the watermark to the given ratio of the image width,
+	// such as 0.2 for a watermark a fifth as wide as the image.
+	Scale float64
+	// Angle rotates the watermark clockwise, in degrees.
+	Angle float64
+	// Gravity, if defined, places the watermark Margin pixels away from the
+	// given edges, offset by Left and Top. Otherwise, Left and Top are the
+	// position of the watermark.
+	Gravity *Gravity
+	Margin  int
+	// Tile repeats the watermark over the whole image, Spacing pixels
+	// apart, starting from Left and Top.
+	Tile    bool
+	Spacing int
+}
+
+// Modulate represents the colour adjustments applied in LCh space.
+type Modulate struct {
+	// Brightness and Saturation change the lightness and the chroma by the
+	// given ratio, such as 0.2 for 20% more, or -1 for none at all, which
+	// makes the image black or fully desaturated. Zero values leave them
+	// unchanged.
+	Brightness float64
+	Saturation float64
+	// Hue rotates the hue, in degrees.
+	Hue float64
+	// Lightness is added to the lightness, from -100 to 100.
+	Lightness float64
+}
+
+// Duotone represents the colours the shadows and the highlights of an image
+// are mapped to, with the tones in between blended in Lab space.
+type Duotone struct {
+	Shadow    Color
+	Highlight Color
+}
+
+// SepiaMatrix returns a Recomb matrix giving images a sepia tone.
+// A new matrix is returned on each call, so it can be changed freely.
+func SepiaMatrix() [][]float64 {
+	return [][]float64{
+		{0.3588, 0.7044, 0.1368},
+		{0.2990, 0.5870, 0.1140},
+		{0.2392, 0.4696, 0.0912},
+	}
+}
+
+// CLAHE represents the contrast limited adaptive histogram equalisation
+// options. Each pixel is equalised with the histogram of the Width x Height
+// region around it, with MaxSlope limiting the contrast gain (libvips 8.5+).
+// A zero MaxSlope means no limit.
+type CLAHE struct {
+	Width    int
+	Height   int
+	MaxSlope int
 }
 
 // GaussianBlur represents the gaussian image transformation values.
@@ -276,7 +697,123 @@ type Options struct {
 	// 0-8 for AVIF encoding.
 	// 0-9 for PNG encoding.
 	Speed int
+	// Fit defines how the image is resized to Width and Height, taking
+	// precedence over Crop, Embed, Force and Enlarge. Fit modes scale up
+	// or down as needed; with a single dimension the aspect ratio is kept.
+	Fit Fit
+	// RotateDegrees rotates the image clockwise by an arbitrary angle,
+	// using Interpolator and filling the uncovered corners with RotateBackground.
+	RotateDegrees    float64
+	RotateBackground ColorRGBA
+	// RotateCrop crops the rotated image to the largest inscribed
+	// rectangle, removing the filled corners.
+	RotateCrop bool
+	// FocalPoint, if defined, takes precedence over Gravity when cropping:
+	// the crop is centred on it as much as the image bounds allow.
+	FocalPoint *FocalPoint
+	// SmartCropStrategy defines how smart crop finds the area to keep.
+	SmartCropStrategy SmartCropStrategy
+	// Padding adds space around the transformed image, filled according
+	// to Extend and Background, or CanvasBackground if defined.
+	Padding Padding
+	// AspectRatio extends the canvas of the transformed image to the given
+	// width to height ratio, positioning the image according to Gravity.
+	AspectRatio AspectRatio
+	// CanvasBackground, if defined, fills the area added by Embed, Padding
+	// and AspectRatio, taking precedence over Extend and Background.
+	// An alpha channel is added to the image if the colour is not opaque.
+	CanvasBackground *ColorRGBA
+	// CropAspect crops the largest area of the given width to height ratio,
+	// after any resize, choosing it according to FocalPoint or Gravity
+	// (including smart crop). It takes precedence over Crop and Embed.
+	CropAspect AspectRatio
+	// TrimAlpha makes Trim remove the transparent borders of the image
+	// using its alpha channel, instead of comparing against Background.
+	TrimAlpha bool
+	// DPR defines the device pixel ratio the image is rendered for, scaling
+	// Width, Height and the watermark metrics. Unless Enlarge is set, it is
+	// reduced as needed to not exceed the source dimensions.
+	DPR float64
+	// Affine transforms the image with the [a, b, c, d] matrix before
+	// resizing, mapping each (x, y) to (a*x + b*y, c*x + d*y). The output
+	// covers the transformed image, within which AffineTranslate moves the
+	// result. Uncovered areas are filled according to Extend.
+	Affine          [4]float64
+	AffineTranslate [2]float64
+	// Perspective, if defined, warps the image before resizing (libvips 8.7+),
+	// for instance to straighten a photographed document.
+	Perspective *Perspective
+	// CornerRadius rounds the corners of the output image, making them
+	// transparent. Circle instead crops the centred square of the image and
+	// masks it with a circle. Mask is an image buffer whose alpha channel,
+	// or luminance if it has none, is stretched to the output size and
+	// multiplied into its alpha. Masked images are not flattened onto
+	// Background, and are saved as PNG unless Type is defined. Explicit JPEG
+	// output is flattened onto Background instead.
+	CornerRadius int
+	Circle       bool
+	Mask         []byte
+	// Composite places the given layers over the image, in order,
+	// after the watermarks (libvips 8.6+).
+	Composite []Layer
+	// Modulate adjusts the brightness, saturation, hue and lightness.
+	Modulate *Modulate
+	// Normalise stretches the luminance to the full range, mapping the
+	// NormaliseLower and NormaliseUpper percentiles to black and white.
+	// They default to 1 and 99 when both are zero, and NormaliseUpper to 99
+	// when only NormaliseLower is set. Equalize equalises the luminance histogram, and
+	// CLAHE does so locally. These apply to the luminance only, along with
+	// the other effects. Equalize and CLAHE work on an 8-bit luminance, so
+	// 16-bit images lose precision in their luminance.
+	Normalise      bool
+	NormaliseLower float64
+	NormaliseUpper float64
+	Equalize       bool
+	CLAHE          CLAHE
+	// Recomb multiplies the colour bands with the given 3x3 matrix, or 4x4
+	// to include alpha, such as SepiaMatrix(). Greyscale removes the colours,
+	// Tint colours the image with the hue of the given colour and Duotone
+	// maps its shadows and highlights to two colours. These apply in this
+	// order, before encoding. Unless Tint or Duotone follow, Greyscale output
+	// defaults to InterpretationBW, or InterpretationGREY16 for 16-bit images.
+	Recomb    [][]float64
+	Greyscale bool
+	Tint      *Color
+	Duotone   *Duotone
 
 	// private fields
 	autoRotateOnly bool
+	result         *ResizeResult
+}
+
+// ResizeResult represents additional information about a transformation,
+// as returned by ResizeWithResult.
+type ResizeResult struct {
+	// Width and Height of the resultant image.
+	Width  int
+	Height int
+	// SmartCrop stores the area selected by smart crop, if it was applied.
+	SmartCrop *SmartCropResult
+	// Trim stores the area kept by Trim, if it was applied.
+	Trim *Rect
+	// DPR is the effective device pixel ratio, if Options.DPR was defined.
+	DPR float64
+}
+
+// SmartCropResult represents the area of an image selected by smart crop.
+type SmartCropResult struct {
+	// Box is the kept area, in the coordinates of the image the crop was
+	// applied to, whose size is ImageSize (that is, after shrinking).
+	Box       Rect
+	ImageSize ImageSize
+	// HasAttention reports whether AttentionX and AttentionY locate the most
+	// interesting point found by SmartCropAttention, in the same coordinates
+	// as Box. It is only reported by libvips 8.8+.
+	HasAttention bool
+	AttentionX   int
+	AttentionY   int
+	// FocalPoint is the relative centre of interest: the attention point
+	// when known, or the centre of Box otherwise. It can be passed as
+	// Options.FocalPoint to render other sizes with a consistent crop.
+	FocalPoint FocalPoint
 }
@@ -0,0 +1,237 @@
+package bimg
+
+/*
+#cgo pkg-config: vips
+#include "vips/vips.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"unsafe"
+)
+
+// BandFormat represents the numeric format of each pixel band.
+// See: https://libvips.github.io/libvips/API/current/VipsImage.html#VipsBandFormat
+type BandFormat int
+
+const (
+	// BandFormatUchar represents unsigned 8-bit pixel bands.
+	BandFormatUchar BandFormat = C.VIPS_FORMAT_UCHAR
+	// BandFormatChar represents signed 8-bit pixel bands.
+	BandFormatChar BandFormat = C.VIPS_FORMAT_CHAR
+	// BandFormatUshort represents unsigned 16-bit pixel bands.
+	BandFormatUshort BandFormat = C.VIPS_FORMAT_USHORT
+	// BandFormatShort represents signed 16-bit pixel bands.
+	BandFormatShort BandFormat = C.VIPS_FORMAT_SHORT
+	// BandFormatUint represents unsigned 32-bit pixel bands.
+	BandFormatUint BandFormat = C.VIPS_FORMAT_UINT
+	// BandFormatInt represents signed 32-bit pixel bands.
+	BandFormatInt BandFormat = C.VIPS_FORMAT_INT
+	// BandFormatFloat represents 32-bit floating point pixel bands.
+	BandFormatFloat BandFormat = C.VIPS_FORMAT_FLOAT
+	// BandFormatDouble represents 64-bit floating point pixel bands.
+	BandFormatDouble BandFormat = C.VIPS_FORMAT_DOUBLE
+)
+
+var bandFormatSizes = map[BandFormat]int{
+	BandFormatUchar:  1,
+	BandFormatChar:   1,
+	BandFormatUshort: 2,
+	BandFormatShort:  2,
+	BandFormatUint:   4,
+	BandFormatInt:    4,
+	BandFormatFloat:  4,
+	BandFormatDouble: 8,
+}
+
+// Size returns the size in bytes of a single band value, or 0 if the
+// format is not supported.
+func (f BandFormat) Size() int {
+	return bandFormatSizes[f]
+}
+
+// RawImage represents uncompressed pixel data, stored band interleaved
+// and row by row in the host byte order.
+type RawImage struct {
+	Width  int
+	Height int
+	Bands  int
+	Format BandFormat
+	Pixels []byte
+}
+
+// Float32 returns the pixel values as float32, converting them from
+// the raw band format if necessary.
+func (r RawImage) Float32() ([]float32, error) {
+	size := r.Format.Size()
+	if size == 0 {
+		return nil, errors.New("Unsupported band format")
+	}
+
+	n := len(r.Pixels) / size
+	out := make([]float32, n)
+	if n == 0 {
+		return out, nil
+	}
+
+	ptr := unsafe.Pointer(&r.Pixels[0])
+	switch r.Format {
+	case BandFormatUchar:
+		for i, v := range r.Pixels {
+			out[i] = float32(v)
+		}
+	case BandFormatChar:
+		for i, v := range (*[math.MaxInt32]int8)(ptr)[:n:n] {
+			out[i] = float32(v)
+		}
+	case BandFormatUshort:
+		for i, v := range (*[math.MaxInt32 / 2]uint16)(ptr)[:n:n] {
+			out[i] = float32(v)
+		}
+	case BandFormatShort:
+		for i, v := range (*[math.MaxInt32 / 2]int16)(ptr)[:n:n] {
+			out[i] = float32(v)
+		}
+	case BandFormatUint:
+		for i, v := range (*[math.MaxInt32 / 4]uint32)(ptr)[:n:n] {
+			out[i] = float32(v)
+		}
+	case BandFormatInt:
+		for i, v := range (*[math.MaxInt32 / 4]int32)(ptr)[:n:n] {
+			out[i] = float32(v)
+		}
+	case BandFormatFloat:
+		copy(out, (*[math.MaxInt32 / 4]float32)(ptr)[:n:n])
+	case BandFormatDouble:
+		for i, v := range (*[math.MaxInt32 / 8]float64)(ptr)[:n:n] {
+			out[i] = float32(v)
+		}
+	}
+
+	return out, nil
+}
+
+// ExportRaw transforms the given image buffer with the passed options
+// and returns the resultant decoded pixels instead of an encoded image.
+func ExportRaw(buf []byte, o Options) (RawImage, error) {
+	defer C.vips_thread_shutdown()
+	defer runtime.KeepAlive(buf)
+
+	image, imageType, err := loadImage(buf)
+	if err != nil {
+		return RawImage{}, err
+	}
+
+	return exportRaw(image, imageType, buf, o)
+}
+
+// NewImageFromRaw creates a new Image from uncompressed, band interleaved
+// pixel data. Pixels are copied, so the given slice can be reused.
+// The image stays decoded until the first call to Process, which encodes
+// it to o.Type (PNG by default).
+func NewImageFromRaw(pixels []byte, width, height, bands int, format BandFormat) (*Image, error) {
+	if width <= 0 || height <= 0 || bands <= 0 {
+		return nil, errors.New("Raw image width, height and bands must be higher than zero")
+	}
+	if format.Size() == 0 {
+		return nil, errors.New("Unsupported band format")
+	}
+
+	raw := &RawImage{
+		Width:  width,
+		Height: height,
+		Bands:  bands,
+		Format: format,
+		Pixels: append([]byte(nil), pixels...),
+	}
+	if len(raw.Pixels) != width*height*bands*format.Size() {
+		return nil, errors.New("Raw pixel buffer size does not match the image dimensions")
+	}
+
+	return &Image{raw: raw}, nil
+}
+
+func resizerRaw(r RawImage, o Options) ([]byte, error) {
+	defer C.vips_thread_shutdown()
+
+	image, err := vipsReadRaw(r)
+	if err != nil {
+		return nil, err
+	}
+
+	o = applyDefaults(o, PNG)
+
+	// Ensure supported type
+	if !IsTypeSupportedSave(o.Type) {
+		return nil, errors.New("Unsupported image output type")
+	}
+
+	image, err = processImage(image, UNKNOWN, nil, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return saveImage(image, o)
+}
+
+func rawMetadata(r RawImage) (ImageMetadata, error) {
+	defer C.vips_thread_shutdown()
+
+	image, err := vipsReadRaw(r)
+	if err != nil {
+		return ImageMetadata{}, err
+	}
+	defer C.g_object_unref(C.gpointer(image))
+
+	return imageMetadata(image, UNKNOWN), nil
+}
+
+func rawInterpretation(r RawImage) (Interpretation, error) {
+	defer C.vips_thread_shutdown()
+
+	image, err := vipsReadRaw(r)
+	if err != nil {
+		return InterpretationError, err
+	}
+	defer C.g_object_unref(C.gpointer(image))
+
+	return vipsInterpretation(image), nil
+}
+
+func rawColourspaceIsSupported(r RawImage) (bool, error) {
+	defer C.vips_thread_shutdown()
+
+	image, err := vipsReadRaw(r)
+	if err != nil {
+		return false, err
+	}
+	defer C.g_object_unref(C.gpointer(image))
+
+	return vipsColourspaceIsSupported(image), nil
+}
+
+func exportRawFromRaw(r RawImage, o Options) (RawImage, error) {
+	defer C.vips_thread_shutdown()
+
+	image, err := vipsReadRaw(r)
+	if err != nil {
+		return RawImage{}, err
+	}
+
+	return exportRaw(image, UNKNOWN, nil, o)
+}
+
+func exportRaw(image *C.VipsImage, imageType ImageType, buf []byte, o Options) (RawImage, error) {
+	o = applyDefaults(o, imageType)
+
+	image, err := processImage(image, imageType, buf, o)
+	if err != nil {
+		return RawImage{}, err
+	}
+	o.Interpretation = outputInterpretation(image, o)
+
+	return vipsExportRaw(image, getSaveOptions(o))
+}
@@ -0,0 +1,89 @@
+package bimg
+
+import (
+	"testing"
+)
+
+func TestExportRaw(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+
+	raw, err := ExportRaw(buf, Options{Width: 300, Height: 200, Crop: true})
+	if err != nil {
+		t.Fatalf("Cannot export raw pixels: %s", err)
+	}
+
+	if raw.Width != 300 || raw.Height != 200 {
+		t.Fatalf("Invalid image size: %dx%d", raw.Width, raw.Height)
+	}
+	if raw.Bands != 3 || raw.Format != BandFormatUchar {
+		t.Fatalf("Invalid pixel layout: %d bands, format %d", raw.Bands, raw.Format)
+	}
+	if len(raw.Pixels) != 300*200*3 {
+		t.Fatalf("Invalid pixel buffer length: %d", len(raw.Pixels))
+	}
+
+	pixels, err := raw.Float32()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pixels) != len(raw.Pixels) || pixels[0] != float32(raw.Pixels[0]) {
+		t.Fatal("Invalid float32 pixel conversion")
+	}
+}
+
+func TestNewImageFromRaw(t *testing.T) {
+	width, height := 64, 32
+	pixels := make([]byte, width*height*4)
+	for i := 0; i < len(pixels); i += 4 {
+		pixels[i] = 255
+		pixels[i+3] = 128
+	}
+
+	image, err := NewImageFromRaw(pixels, width, height, 4, BandFormatUchar)
+	if err != nil {
+		t.Fatalf("Cannot create image from raw pixels: %s", err)
+	}
+
+	size, _ := image.Size()
+	if size.Width != width || size.Height != height {
+		t.Fatalf("Invalid image size: %dx%d", size.Width, size.Height)
+	}
+
+	meta, err := image.Metadata()
+	if err != nil {
+		t.Fatalf("Cannot read raw image metadata: %s", err)
+	}
+	if meta.Size.Width != width || meta.Size.Height != height || meta.Channels != 4 || !meta.Alpha {
+		t.Fatalf("Invalid raw image metadata: %#v", meta)
+	}
+	if image.Type() != "unknown" {
+		t.Fatalf("Invalid raw image type: %s", image.Type())
+	}
+	if image.Image() != nil {
+		t.Fatal("Expected no buffer before processing")
+	}
+
+	buf, err := image.Process(Options{Width: 32})
+	if err != nil {
+		t.Fatalf("Cannot process the image: %s", err)
+	}
+
+	if DetermineImageType(buf) != PNG {
+		t.Fatal("Image is not png")
+	}
+	if err := assertSize(buf, 32, 16); err != nil {
+		t.Error(err)
+	}
+
+	meta, _ = Metadata(buf)
+	if !meta.Alpha {
+		t.Fatal("Expected alpha channel to be preserved")
+	}
+}
+
+func TestNewImageFromRawInvalidLength(t *testing.T) {
+	_, err := NewImageFromRaw(make([]byte, 10), 4, 4, 3, BandFormatUchar)
+	if err == nil {
+		t.Fatal("Expected error for mismatched pixel buffer length")
+	}
+}
@@ -0,0 +1,81 @@
+// Package register registers bimg decoders within the standard image package,
+// so image.Decode and image.DecodeConfig can read the formats the Go standard
+// library does not support (WebP, AVIF, HEIF, JPEG XL, TIFF and SVG).
+//
+// It is intended to be imported for its side effects only:
+//
+//	import _ "github.com/h2non/bimg/register"
+//
+// Only the formats supported by the current libvips compilation are registered.
+// As image.Decode only matches the first bytes, HEIF images using the generic
+// mif1 or msf1 brands, which AVIF images share, are not registered, and SVG
+// images must start with the svg element or its doctype, as an XML declaration
+// does not tell them apart from any other XML document.
+package register
+
+import (
+	"errors"
+	"image"
+	"io"
+	"io/ioutil"
+
+	"github.com/h2non/bimg"
+)
+
+// formats stores the magic strings of every registered image type,
+// using "?" as wildcard as expected by image.RegisterFormat.
+var formats = []struct {
+	Type  bimg.ImageType
+	Magic []string
+}{
+	{bimg.WEBP, []string{"RIFF????WEBP"}},
+	{bimg.AVIF, []string{"????ftypavif"}},
+	{bimg.HEIF, []string{"????ftypheic", "????ftypheis", "????ftyphevc"}},
+	{bimg.JXL, []string{"\xff\x0a", "\x00\x00\x00\x0cJXL \x0d\x0a\x87\x0a"}},
+	{bimg.TIFF, []string{"II*\x00", "MM\x00*"}},
+	{bimg.SVG, []string{"<svg", "<!DOCTYPE svg"}},
+}
+
+func init() {
+	for _, format := range formats {
+		if !bimg.IsTypeSupported(format.Type) {
+			continue
+		}
+		name := bimg.ImageTypeName(format.Type)
+		for _, magic := range format.Magic {
+			image.RegisterFormat(name, magic, decoder(format.Type), configDecoder(format.Type))
+		}
+	}
+}
+
+func decoder(t bimg.ImageType) func(io.Reader) (image.Image, error) {
+	return func(r io.Reader) (image.Image, error) {
+		buf, err := read(r, t)
+		if err != nil {
+			return nil, err
+		}
+		return bimg.ToImage(buf, bimg.Options{NoAutoRotate: true})
+	}
+}
+
+func configDecoder(t bimg.ImageType) func(io.Reader) (image.Config, error) {
+	return func(r io.Reader) (image.Config, error) {
+		buf, err := read(r, t)
+		if err != nil {
+			return image.Config{}, err
+		}
+		return bimg.ImageConfig(buf)
+	}
+}
+
+// read reads the whole image and ensures libvips detects the expected type.
+func read(r io.Reader, t bimg.ImageType) ([]byte, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if bimg.DetermineImageType(buf) != t {
+		return nil, errors.New("bimg: invalid " + bimg.ImageTypeName(t) + " image")
+	}
+	return buf, nil
+}
@@ -0,0 +1,77 @@
+package register
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/h2non/bimg"
+)
+
+func TestDecode(t *testing.T) {
+	files := []struct {
+		name   string
+		format bimg.ImageType
+	}{
+		{"test.webp", bimg.WEBP},
+		{"test.svg", bimg.SVG},
+		{"test.avif", bimg.AVIF},
+		{"test.heic", bimg.HEIF},
+		{"test.jxl", bimg.JXL},
+	}
+
+	for _, file := range files {
+		if !bimg.IsTypeSupported(file.format) {
+			continue
+		}
+
+		buf, err := bimg.Read("../testdata/" + file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.format == bimg.SVG {
+			// Only SVG documents without XML declaration are detected
+			buf = buf[bytes.Index(buf, []byte("<svg")):]
+		}
+
+		size, err := bimg.Size(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		img, name, err := image.Decode(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("Cannot decode %s: %s", file.name, err)
+		}
+		if name != bimg.ImageTypeName(file.format) {
+			t.Errorf("Invalid format name for %s: %s", file.name, name)
+		}
+		if img.Bounds().Dx() != size.Width || img.Bounds().Dy() != size.Height {
+			t.Errorf("Invalid image size for %s: %dx%d", file.name, img.Bounds().Dx(), img.Bounds().Dy())
+		}
+
+		config, name, err := image.DecodeConfig(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("Cannot decode config of %s: %s", file.name, err)
+		}
+		if config.Width != size.Width || config.Height != size.Height {
+			t.Errorf("Invalid config size for %s: %dx%d", file.name, config.Width, config.Height)
+		}
+		if config.ColorModel != img.ColorModel() {
+			t.Errorf("Color model mismatch for %s", file.name)
+		}
+	}
+}
+
+func TestDecodeUnknownFormats(t *testing.T) {
+	files := map[string][]byte{
+		"xml":  []byte(`<?xml version="1.0"?><feed></feed>`),
+		"mif1": []byte("\x00\x00\x00\x20ftypmif1\x00\x00\x00\x00mif1avifmiaf"),
+	}
+
+	for name, buf := range files {
+		if _, _, err := image.DecodeConfig(bytes.NewReader(buf)); err != image.ErrFormat {
+			t.Errorf("Expected unknown format error for %s, got: %v", name, err)
+		}
+	}
+}
@@ -14,3 +14,13 @@ func Resize(buf []byte, o Options) ([]byte, error) {
 	defer runtime.KeepAlive(buf)
 	return resizer(buf, o)
 }
+
+// ResizeWithResult works like Resize, and also returns additional
+// information about the transformation, such as the area selected by smart crop.
+func ResizeWithResult(buf []byte, o Options) ([]byte, ResizeResult, error) {
+	defer runtime.KeepAlive(buf)
+	var result ResizeResult
+	o.result = &result
+	image, err := resizer(buf, o)
+	return image, result, err
+}
@@ -8,3 +8,13 @@ package bimg
 func Resize(buf []byte, o Options) ([]byte, error) {
 	return resizer(buf, o)
 }
+
+// ResizeWithResult works like Resize, and also returns additional
+// information about the transformation, such as the area selected by smart crop.
+// Used as proxy to resizer() only in Go <= 1.6 versions
+func ResizeWithResult(buf []byte, o Options) ([]byte, ResizeResult, error) {
+	var result ResizeResult
+	o.result = &result
+	image, err := resizer(buf, o)
+	return image, result, err
+}
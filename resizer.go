@@ -35,13 +35,21 @@ func resizer(buf []byte, o Options) ([]byte, error) {
 		return nil, errors.New("Unsupported image output type")
 	}
 
+	image, err = processImage(image, imageType, buf, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return saveImage(image, o)
+}
+
+// processImage runs the transformation pipeline over an already
+// loaded image. The source buffer is only used for shrink-on-load and
+// may be nil for images which were not decoded from a buffer.
+func processImage(image *C.VipsImage, imageType ImageType, buf []byte, o Options) (*C.VipsImage, error) {
 	// Autorate only
 	if o.autoRotateOnly {
-		image, err = vipsAutoRotate(image)
-		if err != nil {
-			return nil, err
-		}
-		return saveImage(image, o)
+		return vipsAutoRotate(image)
 	}
 
 	// Auto rotate image based on EXIF orientation header
@@ -58,6 +66,34 @@ func resizer(buf []byte, o Options) ([]byte, error) {
 		}
 	}
 
+	// Apply a perspective warp, if necessary
+	if o.Perspective != nil {
+		image, err = perspectiveImage(image, o)
+		if err != nil {
+			return nil, err
+		}
+		buf = nil
+	}
+
+	// Apply an affine transformation, if necessary
+	if o.Affine != [4]float64{} || o.AffineTranslate != [2]float64{} {
+		image, err = affineImage(image, o)
+		if err != nil {
+			return nil, err
+		}
+		buf = nil
+	}
+
+	// Rotate by an arbitrary angle, if necessary
+	if o.RotateDegrees != 0 {
+		image, err = rotateImageByDegrees(image, o)
+		if err != nil {
+			return nil, err
+		}
+		// The source buffer no longer matches the image, disable shrink-on-load
+		buf = nil
+	}
+
 	inWidth := int(image.Xsize)
 	inHeight := int(image.Ysize)
 
@@ -84,7 +120,7 @@ func resizer(buf []byte, o Options) ([]byte, error) {
 	// Try to use libjpeg/libwebp shrink-on-load
 	supportsShrinkOnLoad := imageType == WEBP && VipsMajorVersion >= 8 && VipsMinorVersion >= 3
 	supportsShrinkOnLoad = supportsShrinkOnLoad || imageType == JPEG
-	if supportsShrinkOnLoad && shrink >= 2 {
+	if supportsShrinkOnLoad && len(buf) > 0 && shrink >= 2 {
 		tmpImage, factor, err := shrinkOnLoad(buf, image, imageType, factor, shrink)
 		if err != nil {
 			return nil, err
@@ -118,6 +154,12 @@ func resizer(buf []byte, o Options) ([]byte, error) {
 		}
 	}
 
+	// Extend the canvas with padding or to an aspect ratio, if necessary
+	image, err = extendCanvas(image, o)
+	if err != nil {
+		return nil, err
+	}
+
 	// Add watermark, if necessary
 	image, err = watermarkImageWithText(image, o.Watermark)
 	if err != nil {
@@ -130,6 +172,18 @@ func resizer(buf []byte, o Options) ([]byte, error) {
 		return nil, err
 	}
 
+	// Composite the layers, if necessary
+	image, err = compositeImage(image, o.Composite)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply rounded corners or alpha masks, if necessary
+	image, err = maskImage(image, o)
+	if err != nil {
+		return nil, err
+	}
+
 	// Flatten image on a background, if necessary
 	image, err = imageFlatten(image, imageType, o)
 	if err != nil {
@@ -154,7 +208,24 @@ func resizer(buf []byte, o Options) ([]byte, error) {
 		return nil, err
 	}
 
-	return saveImage(image, o)
+	// Modulate colours, if necessary
+	image, err = applyModulate(image, o)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply colour effects, if necessary
+	image, err = applyColorEffects(image, o)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.result != nil {
+		o.result.Width = int(image.Xsize)
+		o.result.Height = int(image.Ysize)
+	}
+
+	return image, nil
 }
 
 func loadImage(buf []byte) (*C.VipsImage, ImageType, error) {
@@ -179,8 +250,13 @@ func applyDefaults(o Options, imageType ImageType) Options {
 	}
 	if o.Type == 0 {
 		o.Type = imageType
+		// Masks produce transparency, which JPEG cannot store
+		if o.Type == JPEG && shouldApplyMask(o) {
+			o.Type = PNG
+		}
 	}
-	if o.Interpretation == 0 {
+	// Greyscale output is resolved once processed, see outputInterpretation
+	if o.Interpretation == 0 && !greyscaleOutput(o) {
 		o.Interpretation = InterpretationSRGB
 	}
 	if o.Palette {
@@ -190,8 +266,31 @@ func applyDefaults(o Options, imageType ImageType) Options {
 	return o
 }
 
+// greyscaleOutput tells if the image is greyscale once processed, which is
+// the case when no colour effect follows Greyscale.
+func greyscaleOutput(o Options) bool {
+	return o.Greyscale && o.Tint == nil && o.Duotone == nil
+}
+
+// outputInterpretation returns the interpretation to save the processed
+// image with. Greyscale output keeps the B_W or GREY16 interpretation the
+// image got, so that 16-bit images stay 16-bit.
+func outputInterpretation(image *C.VipsImage, o Options) Interpretation {
+	if o.Interpretation == 0 && greyscaleOutput(o) {
+		return vipsInterpretation(image)
+	}
+	return o.Interpretation
+}
+
 func saveImage(image *C.VipsImage, o Options) ([]byte, error) {
-	saveOptions := vipsSaveOptions{
+	o.Interpretation = outputInterpretation(image, o)
+
+	// Finally get the resultant buffer
+	return vipsSave(image, getSaveOptions(o))
+}
+
+func getSaveOptions(o Options) vipsSaveOptions {
+	return vipsSaveOptions{
 		Quality:        o.Quality,
 		Type:           o.Type,
 		Compression:    o.Compression,
@@ -205,11 +304,26 @@ func saveImage(image *C.VipsImage, o Options) ([]byte, error) {
 		Palette:        o.Palette,
 		Speed:          o.Speed,
 	}
-	// Finally get the resultant buffer
-	return vipsSave(image, saveOptions)
 }
 
 func normalizeOperation(o *Options, inWidth, inHeight int) {
+	if o.Fit != 0 {
+		// Fit modes always scale the image, as CSS object-fit does
+		o.Enlarge = true
+		o.Crop, o.Embed, o.Force = false, false, false
+		if o.Width > 0 && o.Height > 0 {
+			switch o.Fit {
+			case FitCover:
+				o.Crop = true
+			case FitContain:
+				o.Embed = true
+			case FitFill:
+				o.Force = true
+			}
+		}
+		return
+	}
+
 	if !o.Force && !o.Crop && !o.Embed && !o.Enlarge && o.Rotate == 0 && (o.Width > 0 || o.Height > 0) {
 		o.Force = true
 	}
@@ -218,11 +332,12 @@ func normalizeOperation(o *Options, inWidth, inHeight int) {
 func shouldTransformImage(o Options, inWidth, inHeight int) bool {
 	return o.Force || (o.Width > 0 && o.Width != inWidth) ||
 		(o.Height > 0 && o.Height != inHeight) || o.AreaWidth > 0 || o.AreaHeight > 0 ||
-		o.Trim
+		o.Trim || o.CropAspect > 0
 }
 
 func shouldApplyEffects(o Options) bool {
-	return o.GaussianBlur.Sigma > 0 || o.GaussianBlur.MinAmpl > 0 || o.Sharpen.Radius > 0 && o.Sharpen.Y2 > 0 || o.Sharpen.Y3 > 0
+	return o.GaussianBlur.Sigma > 0 || o.GaussianBlur.MinAmpl > 0 || o.Sharpen.Radius > 0 && o.Sharpen.Y2 > 0 || o.Sharpen.Y3 > 0 ||
+		o.Normalise || o.Equalize || o.CLAHE.Width > 0 || o.CLAHE.Height > 0
 }
 
 func transformImage(image *C.VipsImage, o Options, shrink int, residual float64) (*C.VipsImage, error) {
@@ -265,9 +380,75 @@ func transformImage(image *C.VipsImage, o Options, shrink int, residual float64)
 	return image, nil
 }
 
+func extendCanvas(image *C.VipsImage, o Options) (*C.VipsImage, error) {
+	if o.AspectRatio == 0 && o.Padding == (Padding{}) {
+		return image, nil
+	}
+
+	if o.AspectRatio < 0 {
+		C.g_object_unref(C.gpointer(image))
+		return nil, errors.New("Aspect ratio must be higher than zero")
+	}
+	if o.Padding.Top < 0 || o.Padding.Right < 0 || o.Padding.Bottom < 0 || o.Padding.Left < 0 {
+		C.g_object_unref(C.gpointer(image))
+		return nil, errors.New("Padding cannot be negative")
+	}
+
+	left, top, width, height := calculateCanvas(int(image.Xsize), int(image.Ysize), o.AspectRatio, o.Padding, o.Gravity)
+	return embedImage(image, left, top, width, height, o)
+}
+
+func embedImage(image *C.VipsImage, left, top, width, height int, o Options) (*C.VipsImage, error) {
+	if o.CanvasBackground != nil {
+		return vipsEmbedRGBA(image, left, top, width, height, *o.CanvasBackground)
+	}
+	return vipsEmbed(image, left, top, width, height, o.Extend, o.Background)
+}
+
 func applyEffects(image *C.VipsImage, o Options) (*C.VipsImage, error) {
 	var err error
 
+	if o.Normalise {
+		lower, upper := o.NormaliseLower, o.NormaliseUpper
+		if lower == 0 && upper == 0 {
+			lower = 1
+		}
+		// The upper percentile cannot be zero, unlike the lower one
+		if upper == 0 {
+			upper = 99
+		}
+		if lower < 0 || upper > 100 || lower >= upper {
+			C.g_object_unref(C.gpointer(image))
+			return nil, errors.New("Normalise percentiles must be between 0 and 100, lower first")
+		}
+		image, err = vipsNormalise(image, lower, upper)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if o.Equalize {
+		image, err = vipsEqualize(image)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if o.CLAHE.Width > 0 || o.CLAHE.Height > 0 {
+		if o.CLAHE.Width <= 0 || o.CLAHE.Height <= 0 {
+			C.g_object_unref(C.gpointer(image))
+			return nil, errors.New("CLAHE width and height must be higher than zero")
+		}
+		if o.CLAHE.MaxSlope < 0 {
+			C.g_object_unref(C.gpointer(image))
+			return nil, errors.New("CLAHE max slope cannot be negative")
+		}
+		image, err = vipsCLAHE(image, o.CLAHE)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if o.GaussianBlur.Sigma > 0 || o.GaussianBlur.MinAmpl > 0 {
 		image, err = vipsGaussianBlur(image, o.GaussianBlur)
 		if err != nil {
@@ -285,20 +466,69 @@ func applyEffects(image *C.VipsImage, o Options) (*C.VipsImage, error) {
 	return image, nil
 }
 
+func smartCropImage(image *C.VipsImage, width, height int, o Options) (*C.VipsImage, error) {
+	inWidth, inHeight := int(image.Xsize), int(image.Ysize)
+
+	image, crop, err := vipsSmartCrop(image, width, height, o.SmartCropStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.result != nil {
+		o.result.SmartCrop = newSmartCropResult(crop, inWidth, inHeight)
+	}
+	return image, nil
+}
+
+func trimImage(image *C.VipsImage, o Options) (*C.VipsImage, error) {
+	// Finding the trim area releases the image, keep it for the extract
+	C.g_object_ref(C.gpointer(image))
+
+	var left, top, width, height int
+	var err error
+	if o.TrimAlpha {
+		left, top, width, height, err = vipsTrimAlpha(image, o.Threshold)
+	} else {
+		left, top, width, height, err = vipsTrim(image, o.Background, o.Threshold)
+	}
+	if err != nil {
+		C.g_object_unref(C.gpointer(image))
+		return nil, err
+	}
+
+	if o.result != nil {
+		o.result.Trim = &Rect{Left: left, Top: top, Width: width, Height: height}
+	}
+	return vipsExtract(image, left, top, width, height)
+}
+
 func extractOrEmbedImage(image *C.VipsImage, o Options) (*C.VipsImage, error) {
 	var err error
 	inWidth := int(image.Xsize)
 	inHeight := int(image.Ysize)
 
 	switch {
-	case o.Gravity == GravitySmart, o.SmartCrop:
+	case o.CropAspect > 0:
+		width, height := calculateAspectCrop(inWidth, inHeight, o.CropAspect)
+		// it's already at the requested aspect ratio, return immediately
+		if width == inWidth && height == inHeight {
+			break
+		}
+		if o.FocalPoint == nil && (o.Gravity == GravitySmart || o.SmartCrop) {
+			image, err = smartCropImage(image, width, height, o)
+			break
+		}
+		left, top := calculateCrop(inWidth, inHeight, width, height, o.Gravity, o.FocalPoint)
+		image, err = vipsExtract(image, left, top, width, height)
+		break
+	case o.Fit != FitContain && o.FocalPoint == nil && (o.Gravity == GravitySmart || o.SmartCrop):
 		// it's already at an appropriate size, return immediately
 		if inWidth <= o.Width && inHeight <= o.Height {
 			break
 		}
 		width := int(math.Min(float64(inWidth), float64(o.Width)))
 		height := int(math.Min(float64(inHeight), float64(o.Height)))
-		image, err = vipsSmartCrop(image, width, height)
+		image, err = smartCropImage(image, width, height, o)
 		break
 	case o.Crop:
 		// it's already at an appropriate size, return immediately
@@ -307,19 +537,16 @@ func extractOrEmbedImage(image *C.VipsImage, o Options) (*C.VipsImage, error) {
 		}
 		width := int(math.Min(float64(inWidth), float64(o.Width)))
 		height := int(math.Min(float64(inHeight), float64(o.Height)))
-		left, top := calculateCrop(inWidth, inHeight, o.Width, o.Height, o.Gravity)
+		left, top := calculateCrop(inWidth, inHeight, o.Width, o.Height, o.Gravity, o.FocalPoint)
 		left, top = int(math.Max(float64(left), 0)), int(math.Max(float64(top), 0))
 		image, err = vipsExtract(image, left, top, width, height)
 		break
 	case o.Embed:
 		left, top := (o.Width-inWidth)/2, (o.Height-inHeight)/2
-		image, err = vipsEmbed(image, left, top, o.Width, o.Height, o.Extend, o.Background)
+		image, err = embedImage(image, left, top, o.Width, o.Height, o)
 		break
 	case o.Trim:
-		left, top, width, height, err := vipsTrim(image, o.Background, o.Threshold)
-		if err == nil {
-			image, err = vipsExtract(image, left, top, width, height)
-		}
+		image, err = trimImage(image, o)
 		break
 	case o.Top != 0 || o.Left != 0 || o.AreaWidth != 0 || o.AreaHeight != 0:
 		if o.AreaWidth == 0 {
@@ -369,6 +596,76 @@ func rotateAndFlipImage(image *C.VipsImage, o Options) (*C.VipsImage, bool, erro
 	return image, rotated, err
 }
 
+func rotateImageByDegrees(image *C.VipsImage, o Options) (*C.VipsImage, error) {
+	degrees := math.Mod(o.RotateDegrees, 360)
+	if degrees == 0 {
+		return image, nil
+	}
+
+	inWidth, inHeight := int(image.Xsize), int(image.Ysize)
+
+	image, err := vipsRotateDegrees(image, degrees, o.Interpolator, o.RotateBackground)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.RotateCrop {
+		width, height := calculateInscribedRect(inWidth, inHeight, degrees)
+		left := (int(image.Xsize) - width) / 2
+		top := (int(image.Ysize) - height) / 2
+		image, err = vipsExtract(image, left, top, width, height)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return image, nil
+}
+
+func affineImage(image *C.VipsImage, o Options) (*C.VipsImage, error) {
+	matrix := o.Affine
+	if matrix == [4]float64{} {
+		matrix = [4]float64{1, 0, 0, 1}
+	}
+	if matrix[0]*matrix[3]-matrix[1]*matrix[2] == 0 {
+		return nil, errors.New("Affine matrix is not invertible")
+	}
+
+	area := calculateAffineArea(int(image.Xsize), int(image.Ysize), matrix)
+	if area.Width > maxSize || area.Height > maxSize {
+		return nil, errors.New("Maximum image size exceeded")
+	}
+
+	return vipsAffineTransform(image, matrix, o.AffineTranslate, area, o.Interpolator, o.Extend)
+}
+
+func perspectiveImage(image *C.VipsImage, o Options) (*C.VipsImage, error) {
+	if !(VipsMajorVersion > 8 || (VipsMajorVersion == 8 && VipsMinorVersion >= 7)) {
+		return nil, errors.New("Perspective transform requires libvips 8.7+")
+	}
+
+	p := *o.Perspective
+	if p.Width == 0 || p.Height == 0 {
+		width, height := calculatePerspectiveSize(p.Corners)
+		if p.Width == 0 {
+			p.Width = width
+		}
+		if p.Height == 0 {
+			p.Height = height
+		}
+	}
+	if p.Width <= 0 || p.Height <= 0 {
+		return nil, errors.New("Perspective width and height must be higher than zero")
+	}
+
+	matrix, err := calculateHomography(p.Corners, p.Width, p.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	return vipsPerspective(image, p.Width, p.Height, matrix, o.Interpolator)
+}
+
 func watermarkImageWithText(image *C.VipsImage, w Watermark) (*C.VipsImage, error) {
 	if w.Text == "" {
 		return image, nil
@@ -382,7 +679,10 @@ func watermarkImageWithText(image *C.VipsImage, w Watermark) (*C.VipsImage, erro
 		w.Width = int(math.Floor(float64(image.Xsize / 6)))
 	}
 	if w.DPI == 0 {
-		w.DPI = 150
+		w.DPI = watermarkDPI
+	}
+	if w.Color != nil {
+		return watermarkImageWithTextLayer(image, w)
 	}
 	if w.Margin == 0 {
 		w.Margin = w.Width
@@ -401,6 +701,41 @@ func watermarkImageWithText(image *C.VipsImage, w Watermark) (*C.VipsImage, erro
 	return image, nil
 }
 
+func watermarkImageWithTextLayer(image *C.VipsImage, w Watermark) (*C.VipsImage, error) {
+	if !(VipsMajorVersion > 8 || (VipsMajorVersion == 8 && VipsMinorVersion >= 6)) {
+		return nil, errors.New("Watermark Color requires libvips 8.6+")
+	}
+
+	layer, err := vipsTextLayer(watermarkTextOptions(w), *w.Color, w.BoxColor, w.BoxPadding, w.Angle)
+	if err != nil {
+		return nil, err
+	}
+
+	tile := !w.NoReplicate
+	left, top := w.Left, w.Top
+	if tile {
+		spacing := w.Spacing
+		if spacing == 0 {
+			spacing = w.Margin
+		}
+		if spacing == 0 {
+			spacing = w.Width
+		}
+		layer, err = vipsEmbedRGBA(layer, 0, 0, int(layer.Xsize)+spacing, int(layer.Ysize)+spacing, ColorRGBA{})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		left, top = calculateWatermarkPosition(int(layer.Xsize), int(layer.Ysize), int(image.Xsize), int(image.Ysize), w.Gravity, w.Margin, w.Left, w.Top)
+	}
+
+	if w.Opacity == 0 || w.Opacity > 1 {
+		w.Opacity = 1
+	}
+
+	return vipsComposite(image, layer, left, top, tile, w.Opacity, BlendOver)
+}
+
 func watermarkImageWithAnotherImage(image *C.VipsImage, w WatermarkImage) (*C.VipsImage, error) {
 	if len(w.Buf) == 0 {
 		return image, nil
@@ -419,10 +754,100 @@ func watermarkImageWithAnotherImage(image *C.VipsImage, w WatermarkImage) (*C.Vi
 	return image, nil
 }
 
+func compositeImage(image *C.VipsImage, layers []Layer) (*C.VipsImage, error) {
+	if len(layers) == 0 {
+		return image, nil
+	}
+
+	if !(VipsMajorVersion > 8 || (VipsMajorVersion == 8 && VipsMinorVersion >= 6)) {
+		return nil, errors.New("Composite requires libvips 8.6+")
+	}
+
+	for _, layer := range layers {
+		overlay, _, err := vipsRead(layer.Buf)
+		if err != nil {
+			C.g_object_unref(C.gpointer(image))
+			return nil, err
+		}
+
+		left, top := layer.Left, layer.Top
+		if !layer.Tile && !layer.Absolute {
+			left, top = calculateEmbed(int(overlay.Xsize), int(overlay.Ysize), int(image.Xsize), int(image.Ysize), layer.Gravity)
+		}
+
+		if layer.Opacity == 0 || layer.Opacity > 1 {
+			layer.Opacity = 1
+		}
+
+		image, err = vipsComposite(image, overlay, left, top, layer.Tile, layer.Opacity, layer.Blend)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return image, nil
+}
+
+func shouldApplyMask(o Options) bool {
+	return o.Circle || o.CornerRadius > 0 || len(o.Mask) > 0
+}
+
+func maskImage(image *C.VipsImage, o Options) (*C.VipsImage, error) {
+	var err error
+
+	if o.Circle || o.CornerRadius > 0 {
+		width, height := int(image.Xsize), int(image.Ysize)
+		radius := float64(o.CornerRadius)
+
+		if o.Circle {
+			size := int(math.Min(float64(width), float64(height)))
+			if width != height {
+				image, err = vipsExtract(image, (width-size)/2, (height-size)/2, size, size)
+				if err != nil {
+					return nil, err
+				}
+			}
+			width, height = size, size
+			radius = float64(size) / 2
+		}
+
+		radius = math.Min(radius, math.Min(float64(width), float64(height))/2)
+		mask, err := vipsRoundedMask(width, height, radius)
+		if err != nil {
+			C.g_object_unref(C.gpointer(image))
+			return nil, err
+		}
+
+		image, err = vipsMask(image, mask)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(o.Mask) > 0 {
+		mask, _, err := vipsRead(o.Mask)
+		if err != nil {
+			C.g_object_unref(C.gpointer(image))
+			return nil, err
+		}
+
+		image, err = vipsMask(image, mask)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return image, nil
+}
+
 func imageFlatten(image *C.VipsImage, imageType ImageType, o Options) (*C.VipsImage, error) {
 	if o.Background == ColorBlack {
 		return image, nil
 	}
+	// Keep the transparency of masks, unless the output cannot store it
+	if shouldApplyMask(o) && o.Type != JPEG {
+		return image, nil
+	}
 	return vipsFlattenBackground(image, o.Background)
 }
 
@@ -502,6 +927,10 @@ func shrinkOnLoad(buf []byte, input *C.VipsImage, imageType ImageType, factor fl
 }
 
 func imageCalculations(o *Options, inWidth, inHeight int) float64 {
+	if o.DPR > 0 {
+		applyDPR(o, inWidth, inHeight)
+	}
+
 	factor := 1.0
 	xfactor := float64(inWidth) / float64(o.Width)
 	yfactor := float64(inHeight) / float64(o.Height)
@@ -509,9 +938,18 @@ func imageCalculations(o *Options, inWidth, inHeight int) float64 {
 	switch {
 	// Fixed width and height
 	case o.Width > 0 && o.Height > 0:
-		if o.Crop {
+		switch {
+		case o.Fit == FitInside:
+			factor = math.Max(xfactor, yfactor)
+			o.Width = roundFloat(float64(inWidth) / factor)
+			o.Height = roundFloat(float64(inHeight) / factor)
+		case o.Fit == FitOutside:
 			factor = math.Min(xfactor, yfactor)
-		} else {
+			o.Width = roundFloat(float64(inWidth) / factor)
+			o.Height = roundFloat(float64(inHeight) / factor)
+		case o.Crop:
+			factor = math.Min(xfactor, yfactor)
+		default:
 			factor = math.Max(xfactor, yfactor)
 		}
 	// Fixed width, auto height
@@ -540,6 +978,56 @@ func imageCalculations(o *Options, inWidth, inHeight int) float64 {
 	return factor
 }
 
+// applyDPR scales the target dimensions and watermark metrics by the device
+// pixel ratio, which is limited by the source dimensions unless enlarging.
+func applyDPR(o *Options, inWidth, inHeight int) {
+	dpr := o.DPR
+	if o.Width == 0 && o.Height == 0 {
+		dpr = 1
+	}
+
+	if dpr > 1 && !o.Enlarge {
+		limit := math.Inf(1)
+		if o.Width > 0 {
+			limit = math.Min(limit, float64(inWidth)/float64(o.Width))
+		}
+		if o.Height > 0 {
+			limit = math.Min(limit, float64(inHeight)/float64(o.Height))
+		}
+		dpr = math.Max(math.Min(dpr, limit), 1)
+	}
+
+	scale := func(v int) int {
+		return roundFloat(float64(v) * dpr)
+	}
+
+	// The default text watermark resolution is scaled too, the other
+	// watermark defaults derive from the already scaled image size
+	if o.Watermark.Text != "" && o.Watermark.DPI == 0 {
+		o.Watermark.DPI = watermarkDPI
+	}
+
+	o.Width = scale(o.Width)
+	o.Height = scale(o.Height)
+	o.Watermark.Width = scale(o.Watermark.Width)
+	o.Watermark.DPI = scale(o.Watermark.DPI)
+	o.Watermark.Margin = scale(o.Watermark.Margin)
+	o.Watermark.Left = scale(o.Watermark.Left)
+	o.Watermark.Top = scale(o.Watermark.Top)
+	o.Watermark.Spacing = scale(o.Watermark.Spacing)
+	o.Watermark.BoxPadding = scale(o.Watermark.BoxPadding)
+	o.WatermarkImage.Left = scale(o.WatermarkImage.Left)
+	o.WatermarkImage.Top = scale(o.WatermarkImage.Top)
+	o.WatermarkImage.Margin = scale(o.WatermarkImage.Margin)
+	o.WatermarkImage.Spacing = scale(o.WatermarkImage.Spacing)
+	o.CornerRadius = scale(o.CornerRadius)
+
+	o.DPR = dpr
+	if o.result != nil {
+		o.result.DPR = dpr
+	}
+}
+
 func roundFloat(f float64) int {
 	if f < 0 {
 		return int(math.Ceil(f - 0.5))
@@ -547,9 +1035,18 @@ func roundFloat(f float64) int {
 	return int(math.Floor(f + 0.5))
 }
 
-func calculateCrop(inWidth, inHeight, outWidth, outHeight int, gravity Gravity) (int, int) {
+func calculateCrop(inWidth, inHeight, outWidth, outHeight int, gravity Gravity, focal *FocalPoint) (int, int) {
 	left, top := 0, 0
 
+	if focal != nil {
+		// Centre the crop on the focal point, keeping it within the image bounds
+		left = roundFloat(focal.X*float64(inWidth) - float64(outWidth)/2)
+		top = roundFloat(focal.Y*float64(inHeight) - float64(outHeight)/2)
+		left = int(math.Max(math.Min(float64(left), float64(inWidth-outWidth)), 0))
+		top = int(math.Max(math.Min(float64(top), float64(inHeight-outHeight)), 0))
+		return left, top
+	}
+
 	switch gravity {
 	case GravityNorth:
 		left = (inWidth - outWidth + 1) / 2
@@ -561,6 +1058,15 @@ func calculateCrop(inWidth, inHeight, outWidth, outHeight int, gravity Gravity)
 		top = inHeight - outHeight
 	case GravityWest:
 		top = (inHeight - outHeight + 1) / 2
+	case GravityNorthEast:
+		left = inWidth - outWidth
+	case GravityNorthWest:
+		// Already anchored to the top-left corner
+	case GravitySouthEast:
+		left = inWidth - outWidth
+		top = inHeight - outHeight
+	case GravitySouthWest:
+		top = inHeight - outHeight
 	default:
 		left = (inWidth - outWidth + 1) / 2
 		top = (inHeight - outHeight + 1) / 2
@@ -569,6 +1075,214 @@ func calculateCrop(inWidth, inHeight, outWidth, outHeight int, gravity Gravity)
 	return left, top
 }
 
+// calculateEmbed returns the position of an image within a larger
+// canvas, according to the given gravity. Any other gravity centres it.
+func calculateEmbed(inWidth, inHeight, outWidth, outHeight int, gravity Gravity) (int, int) {
+	left, top := (outWidth-inWidth)/2, (outHeight-inHeight)/2
+
+	switch gravity {
+	case GravityNorth:
+		top = 0
+	case GravityEast:
+		left = outWidth - inWidth
+	case GravitySouth:
+		top = outHeight - inHeight
+	case GravityWest:
+		left = 0
+	case GravityNorthEast:
+		left, top = outWidth-inWidth, 0
+	case GravityNorthWest:
+		left, top = 0, 0
+	case GravitySouthEast:
+		left, top = outWidth-inWidth, outHeight-inHeight
+	case GravitySouthWest:
+		left, top = 0, outHeight-inHeight
+	}
+
+	return left, top
+}
+
+// calculateWatermarkPosition returns the position of a width x height
+// watermark placed with the given gravity over an image, margin pixels
+// away from the edges the gravity points to and offset by left and top.
+// Text and image watermarks are both placed this way.
+func calculateWatermarkPosition(width, height, imageWidth, imageHeight int, gravity Gravity, margin, offsetLeft, offsetTop int) (int, int) {
+	left, top := calculateEmbed(width, height, imageWidth, imageHeight, gravity)
+
+	switch gravity {
+	case GravityWest, GravityNorthWest, GravitySouthWest:
+		left += margin
+	case GravityEast, GravityNorthEast, GravitySouthEast:
+		left -= margin
+	}
+	switch gravity {
+	case GravityNorth, GravityNorthEast, GravityNorthWest:
+		top += margin
+	case GravitySouth, GravitySouthEast, GravitySouthWest:
+		top -= margin
+	}
+
+	return left + offsetLeft, top + offsetTop
+}
+
+// calculateAspectCrop returns the size of the largest area of the given
+// aspect ratio fitting within a width x height image.
+func calculateAspectCrop(width, height int, ratio AspectRatio) (int, int) {
+	if float64(width)/float64(height) > float64(ratio) {
+		width = int(math.Max(float64(roundFloat(float64(height)*float64(ratio))), 1))
+	} else {
+		height = int(math.Max(float64(roundFloat(float64(width)/float64(ratio))), 1))
+	}
+	return width, height
+}
+
+// calculateCanvas returns the position of the image and the size of the
+// canvas once extended to the aspect ratio, if any, and then padded.
+func calculateCanvas(width, height int, ratio AspectRatio, padding Padding, gravity Gravity) (int, int, int, int) {
+	canvasWidth, canvasHeight := width, height
+	if ratio > 0 {
+		if float64(width)/float64(height) < float64(ratio) {
+			canvasWidth = roundFloat(float64(height) * float64(ratio))
+		} else {
+			canvasHeight = roundFloat(float64(width) / float64(ratio))
+		}
+	}
+
+	left, top := calculateEmbed(width, height, canvasWidth, canvasHeight, gravity)
+
+	return left + padding.Left, top + padding.Top,
+		canvasWidth + padding.Left + padding.Right, canvasHeight + padding.Top + padding.Bottom
+}
+
+// calculateAffineArea returns the bounding box of a width x height image
+// transformed by the [a, b, c, d] matrix.
+func calculateAffineArea(width, height int, matrix [4]float64) Rect {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+
+	for _, corner := range [4]Point{{0, 0}, {float64(width), 0}, {0, float64(height)}, {float64(width), float64(height)}} {
+		x := matrix[0]*corner.X + matrix[1]*corner.Y
+		y := matrix[2]*corner.X + matrix[3]*corner.Y
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+
+	// Tolerate floating point errors before rounding outwards
+	left, top := int(math.Floor(minX+1e-6)), int(math.Floor(minY+1e-6))
+	right, bottom := int(math.Ceil(maxX-1e-6)), int(math.Ceil(maxY-1e-6))
+
+	return Rect{Left: left, Top: top, Width: right - left, Height: bottom - top}
+}
+
+// calculatePerspectiveSize returns the output size of a perspective warp,
+// from the longest opposite edges of the source quadrilateral.
+func calculatePerspectiveSize(corners [4]Point) (int, int) {
+	distance := func(a, b Point) float64 {
+		return math.Hypot(b.X-a.X, b.Y-a.Y)
+	}
+
+	width := math.Max(distance(corners[0], corners[1]), distance(corners[3], corners[2]))
+	height := math.Max(distance(corners[0], corners[3]), distance(corners[1], corners[2]))
+
+	return roundFloat(width), roundFloat(height)
+}
+
+// calculateHomography returns the row-major 3x3 projective matrix which maps
+// the corners of a width x height output onto the source quadrilateral.
+func calculateHomography(corners [4]Point, width, height int) ([9]float64, error) {
+	w, h := float64(width-1), float64(height-1)
+	targets := [4]Point{{0, 0}, {w, 0}, {w, h}, {0, h}}
+
+	// Solve the 8 unknowns with Gauss-Jordan elimination on the augmented matrix
+	var m [8][9]float64
+	for i, t := range targets {
+		c := corners[i]
+		m[i*2] = [9]float64{t.X, t.Y, 1, 0, 0, 0, -t.X * c.X, -t.Y * c.X, c.X}
+		m[i*2+1] = [9]float64{0, 0, 0, t.X, t.Y, 1, -t.X * c.Y, -t.Y * c.Y, c.Y}
+	}
+
+	for col := 0; col < 8; col++ {
+		pivot := col
+		for row := col + 1; row < 8; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return [9]float64{}, errors.New("Perspective corners must define a quadrilateral")
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+
+		for row := 0; row < 8; row++ {
+			if row == col {
+				continue
+			}
+			f := m[row][col] / m[col][col]
+			for k := col; k < 9; k++ {
+				m[row][k] -= f * m[col][k]
+			}
+		}
+	}
+
+	var matrix [9]float64
+	for i := 0; i < 8; i++ {
+		matrix[i] = m[i][8] / m[i][i]
+	}
+	matrix[8] = 1
+
+	return matrix, nil
+}
+
+// newSmartCropResult completes the area selected by smart crop within
+// a width x height image with its relative focal point.
+func newSmartCropResult(crop SmartCropResult, width, height int) *SmartCropResult {
+	crop.ImageSize = ImageSize{Width: width, Height: height}
+
+	box := crop.Box
+	x, y := float64(box.Left)+float64(box.Width)/2, float64(box.Top)+float64(box.Height)/2
+	if crop.HasAttention {
+		x, y = float64(crop.AttentionX), float64(crop.AttentionY)
+	}
+	if width > 0 && height > 0 {
+		crop.FocalPoint = FocalPoint{X: x / float64(width), Y: y / float64(height)}
+	}
+
+	return &crop
+}
+
+// calculateInscribedRect returns the size of the largest axis-aligned
+// rectangle fitting within a width x height rectangle rotated by angle degrees.
+func calculateInscribedRect(width, height int, angle float64) (int, int) {
+	if width <= 0 || height <= 0 {
+		return 0, 0
+	}
+
+	w, h := float64(width), float64(height)
+	sin := math.Abs(math.Sin(angle * math.Pi / 180))
+	cos := math.Abs(math.Cos(angle * math.Pi / 180))
+
+	long, short := math.Max(w, h), math.Min(w, h)
+
+	var wr, hr float64
+	if short <= 2*sin*cos*long || math.Abs(sin-cos) < 1e-10 {
+		// Half constrained case: two crop corners touch the longer side,
+		// the other two corners are on the mid-line parallel to the longer side
+		x := 0.5 * short
+		if w >= h {
+			wr, hr = x/sin, x/cos
+		} else {
+			wr, hr = x/cos, x/sin
+		}
+	} else {
+		// Fully constrained case: crop touches all 4 sides
+		cos2 := cos*cos - sin*sin
+		wr, hr = (w*cos-h*sin)/cos2, (h*cos-w*sin)/cos2
+	}
+
+	// Compensate floating point errors on right angles
+	return int(math.Floor(wr + 1e-6)), int(math.Floor(hr + 1e-6))
+}
+
 func calculateRotationAndFlip(image *C.VipsImage, angle Angle) (Angle, bool) {
 	rotate := D0
 	flip := false
@@ -655,3 +1369,85 @@ func applyContrast(image *C.VipsImage, o Options) (*C.VipsImage, error) {
 	}
 	return image, nil
 }
+
+func applyColorEffects(image *C.VipsImage, o Options) (*C.VipsImage, error) {
+	var err error
+
+	if len(o.Recomb) > 0 {
+		image, err = vipsRecomb(image, o.Recomb)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if o.Greyscale {
+		image, err = vipsGreyscale(image)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if o.Tint != nil {
+		// Keep the lightness, with the hue and chroma of the tint
+		_, a, b := colorToLab(*o.Tint)
+		image, err = vipsDuotone(image, [3]float64{0, a, b}, [3]float64{100, a, b})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if o.Duotone != nil {
+		shadowL, shadowA, shadowB := colorToLab(o.Duotone.Shadow)
+		highlightL, highlightA, highlightB := colorToLab(o.Duotone.Highlight)
+		image, err = vipsDuotone(image, [3]float64{shadowL, shadowA, shadowB}, [3]float64{highlightL, highlightA, highlightB})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return image, nil
+}
+
+// colorToLab converts the given sRGB colour to CIE Lab, with the D65
+// white point libvips uses.
+func colorToLab(c Color) (float64, float64, float64) {
+	linear := func(v uint8) float64 {
+		x := float64(v) / 255
+		if x <= 0.04045 {
+			return x / 12.92
+		}
+		return math.Pow((x+0.055)/1.055, 2.4)
+	}
+	r, g, b := linear(c.R), linear(c.G), linear(c.B)
+
+	x := (0.4124*r + 0.3576*g + 0.1805*b) / 0.95047
+	y := 0.2126*r + 0.7152*g + 0.0722*b
+	z := (0.0193*r + 0.1192*g + 0.9505*b) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389.0 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27.0*t + 16) / 116
+	}
+
+	return 116*f(y) - 16, 500 * (f(x) - f(y)), 200 * (f(y) - f(z))
+}
+
+func applyModulate(image *C.VipsImage, o Options) (*C.VipsImage, error) {
+	if o.Modulate == nil {
+		return image, nil
+	}
+
+	m := *o.Modulate
+	if m.Brightness < -1 || m.Saturation < -1 {
+		C.g_object_unref(C.gpointer(image))
+		return nil, errors.New("Modulate brightness and saturation cannot be lower than -1")
+	}
+
+	// libvips multiplies the lightness and the chroma by these factors
+	m.Brightness++
+	m.Saturation++
+
+	return vipsModulate(image, m)
+}
@@ -7,6 +7,7 @@ import (
 	"image"
 	"image/jpeg"
 	"io/ioutil"
+	"math"
 	"os"
 	"path"
 	"testing"
@@ -161,6 +162,152 @@ func TestResizeCustomSizes(t *testing.T) {
 	}
 }
 
+func TestResizeFit(t *testing.T) {
+	tests := []struct {
+		name          string
+		options       Options
+		width, height int
+	}{
+		{"cover", Options{Width: 800, Height: 800, Fit: FitCover}, 800, 800},
+		{"cover smart", Options{Width: 800, Height: 800, Fit: FitCover, Gravity: GravitySmart}, 800, 800},
+		{"contain", Options{Width: 800, Height: 800, Fit: FitContain}, 800, 800},
+		{"contain smart", Options{Width: 800, Height: 800, Fit: FitContain, Gravity: GravitySmart}, 800, 800},
+		{"fill", Options{Width: 800, Height: 800, Fit: FitFill}, 800, 800},
+		{"inside", Options{Width: 800, Height: 800, Fit: FitInside}, 800, 500},
+		{"outside", Options{Width: 800, Height: 800, Fit: FitOutside}, 1280, 800},
+		{"cover width only", Options{Width: 840, Fit: FitCover}, 840, 525},
+		{"contain height only", Options{Height: 525, Fit: FitContain}, 840, 525},
+		{"inside enlarge", Options{Width: 3360, Height: 3360, Fit: FitInside}, 3360, 2100},
+		{"contain enlarge", Options{Width: 2000, Height: 2000, Fit: FitContain}, 2000, 2000},
+		{"fit overrides flags", Options{Width: 800, Height: 800, Fit: FitInside, Crop: true, Embed: true}, 800, 500},
+	}
+
+	buf, _ := Read("testdata/test.jpg")
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			newImg, err := Resize(buf, tc.options)
+			if err != nil {
+				t.Fatalf("Resize(imgData, %#v) error: %#v", tc.options, err)
+			}
+
+			size, _ := Size(newImg)
+			if size.Width != tc.width || size.Height != tc.height {
+				t.Fatalf("Invalid image size: %dx%d, expected %dx%d", size.Width, size.Height, tc.width, tc.height)
+			}
+		})
+	}
+}
+
+func TestFitCalculations(t *testing.T) {
+	inWidth, inHeight := 1680, 1050
+
+	tests := []struct {
+		options            Options
+		width, height      int
+		factor             float64
+		crop, embed, force bool
+	}{
+		{Options{Width: 800, Height: 800, Fit: FitCover}, 800, 800, 1.3125, true, false, false},
+		{Options{Width: 800, Height: 800, Fit: FitContain}, 800, 800, 2.1, false, true, false},
+		{Options{Width: 800, Height: 800, Fit: FitFill}, 800, 800, 2.1, false, false, true},
+		{Options{Width: 800, Height: 800, Fit: FitInside}, 800, 500, 2.1, false, false, false},
+		{Options{Width: 800, Height: 800, Fit: FitOutside}, 1280, 800, 1.3125, false, false, false},
+		{Options{Width: 840, Fit: FitCover}, 840, 525, 2, false, false, false},
+		{Options{Height: 525, Fit: FitFill}, 840, 525, 2, false, false, false},
+		{Options{Width: 3360, Height: 3360, Fit: FitInside}, 3360, 2100, 0.5, false, false, false},
+		{Options{Width: 800, Height: 800, Fit: FitContain, Crop: true, Force: true}, 800, 800, 2.1, false, true, false},
+	}
+
+	for _, tc := range tests {
+		o := tc.options
+		normalizeOperation(&o, inWidth, inHeight)
+		factor := imageCalculations(&o, inWidth, inHeight)
+
+		if o.Width != tc.width || o.Height != tc.height {
+			t.Errorf("%#v: invalid output size %dx%d, expected %dx%d", tc.options, o.Width, o.Height, tc.width, tc.height)
+		}
+		if factor != tc.factor {
+			t.Errorf("%#v: invalid factor %v, expected %v", tc.options, factor, tc.factor)
+		}
+		if o.Crop != tc.crop || o.Embed != tc.embed || o.Force != tc.force || !o.Enlarge {
+			t.Errorf("%#v: invalid operation flags crop=%v embed=%v force=%v enlarge=%v", tc.options, o.Crop, o.Embed, o.Force, o.Enlarge)
+		}
+	}
+}
+
+func TestDPRCalculations(t *testing.T) {
+	inWidth, inHeight := 1680, 1050
+
+	tests := []struct {
+		options       Options
+		width, height int
+		dpr           float64
+	}{
+		{Options{Width: 400, DPR: 2}, 800, 500, 2},
+		{Options{Width: 400, DPR: 0.5}, 200, 125, 0.5},
+		{Options{Width: 1000, DPR: 2}, 1680, 1050, 1.68},
+		{Options{Width: 1000, DPR: 2, Enlarge: true}, 2000, 1250, 2},
+		{Options{Width: 2000, DPR: 2}, 2000, 1250, 1},
+		{Options{Width: 300, Height: 300, Crop: true, DPR: 4}, 1050, 1050, 3.5},
+		{Options{DPR: 3}, 1680, 1050, 1},
+	}
+
+	for _, tc := range tests {
+		var result ResizeResult
+		o := tc.options
+		o.result = &result
+		imageCalculations(&o, inWidth, inHeight)
+
+		if o.Width != tc.width || o.Height != tc.height {
+			t.Errorf("%#v: invalid output size %dx%d, expected %dx%d", tc.options, o.Width, o.Height, tc.width, tc.height)
+		}
+		if result.DPR != tc.dpr {
+			t.Errorf("%#v: invalid DPR %v, expected %v", tc.options, result.DPR, tc.dpr)
+		}
+	}
+}
+
+func TestDPRWatermarkMetrics(t *testing.T) {
+	o := Options{
+		Width:          400,
+		DPR:            2,
+		Watermark:      Watermark{Width: 100, DPI: 150, Margin: 10},
+		WatermarkImage: WatermarkImage{Left: 5, Top: 15},
+	}
+	imageCalculations(&o, 1680, 1050)
+
+	if o.Watermark.Width != 200 || o.Watermark.DPI != 300 || o.Watermark.Margin != 20 {
+		t.Errorf("Invalid watermark metrics: %#v", o.Watermark)
+	}
+	if o.WatermarkImage.Left != 10 || o.WatermarkImage.Top != 30 {
+		t.Errorf("Invalid watermark image position: %d, %d", o.WatermarkImage.Left, o.WatermarkImage.Top)
+	}
+
+	o = Options{Width: 400, DPR: 2, Watermark: Watermark{Text: "Copyright"}}
+	imageCalculations(&o, 1680, 1050)
+
+	if o.Watermark.DPI != 2*watermarkDPI {
+		t.Errorf("Expected the default watermark DPI to be scaled, got %d", o.Watermark.DPI)
+	}
+}
+
+func TestResizeDPR(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+
+	newImg, result, err := ResizeWithResult(buf, Options{Width: 300, Height: 200, Crop: true, DPR: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := assertSize(newImg, 600, 400); err != nil {
+		t.Error(err)
+	}
+	if result.DPR != 2 {
+		t.Errorf("Invalid effective DPR: %v", result.DPR)
+	}
+}
+
 func TestResizePrecision(t *testing.T) {
 	// see https://github.com/h2non/bimg/issues/99
 	img := image.NewGray16(image.Rect(0, 0, 1920, 1080))
@@ -221,6 +368,67 @@ func TestInvalidRotateDegrees(t *testing.T) {
 	Write("testdata/test_rotate_invalid_out.jpg", newImg)
 }
 
+func TestRotateDegrees(t *testing.T) {
+	if !(VipsMajorVersion >= 8 && VipsMinorVersion >= 6) {
+		t.Skipf("Skipping this test, libvips doesn't meet version requirement %s >= 8.6", VipsVersion)
+	}
+
+	buf, _ := Read("testdata/test.jpg")
+	size, _ := Size(buf)
+
+	tests := []struct {
+		options Options
+		larger  bool
+	}{
+		{Options{RotateDegrees: 30, Type: PNG}, true},
+		{Options{RotateDegrees: -15, Interpolator: Bilinear, RotateBackground: ColorRGBA{255, 255, 255, 255}}, true},
+		{Options{RotateDegrees: 30, RotateCrop: true}, false},
+	}
+
+	for _, tc := range tests {
+		newImg, err := Resize(buf, tc.options)
+		if err != nil {
+			t.Fatalf("Resize(imgData, %#v) error: %#v", tc.options, err)
+		}
+
+		newSize, _ := Size(newImg)
+		larger := newSize.Width > size.Width && newSize.Height > size.Height
+		if larger != tc.larger {
+			t.Errorf("Invalid image size for %#v: %dx%d", tc.options, newSize.Width, newSize.Height)
+		}
+	}
+
+	newImg, _ := Resize(buf, Options{RotateDegrees: 30, Type: PNG})
+	metadata, _ := Metadata(newImg)
+	if !metadata.Alpha {
+		t.Error("Expected transparent corners")
+	}
+
+	Write("testdata/test_rotate_degrees_out.png", newImg)
+}
+
+func TestCalculateInscribedRect(t *testing.T) {
+	tests := []struct {
+		width, height int
+		angle         float64
+		outW, outH    int
+	}{
+		{1920, 1080, 0, 1920, 1080},
+		{1920, 1080, 90, 1080, 1920},
+		{1920, 1080, 180, 1920, 1080},
+		{500, 500, 45, 353, 353},
+		{1920, 1080, 30, 1080, 623},
+		{1920, 1080, -30, 1080, 623},
+	}
+
+	for _, tc := range tests {
+		w, h := calculateInscribedRect(tc.width, tc.height, tc.angle)
+		if w != tc.outW || h != tc.outH {
+			t.Errorf("calculateInscribedRect(%d, %d, %v) = %dx%d, expected %dx%d", tc.width, tc.height, tc.angle, w, h, tc.outW, tc.outH)
+		}
+	}
+}
+
 func TestCorruptedImage(t *testing.T) {
 	options := Options{Width: 800, Height: 600}
 	buf, _ := Read("testdata/corrupt.jpg")
@@ -296,6 +504,24 @@ func TestEmbedExtendWithCustomColor(t *testing.T) {
 	Write("testdata/test_extend_background_out.jpg", newImg)
 }
 
+func TestEmbedIgnoresGravity(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+
+	centred, err := Resize(buf, Options{Width: 400, Height: 400, Embed: true, Type: PNG})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	north, err := Resize(buf, Options{Width: 400, Height: 400, Embed: true, Gravity: GravityNorth, Type: PNG})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if md5.Sum(centred) != md5.Sum(north) {
+		t.Error("Expected Embed to centre the image regardless of Gravity")
+	}
+}
+
 func TestGaussianBlur(t *testing.T) {
 	options := Options{Width: 800, Height: 600, GaussianBlur: GaussianBlur{Sigma: 5}}
 	buf, _ := Read("testdata/test.jpg")
@@ -545,6 +771,58 @@ func TestRotationAndFlip(t *testing.T) {
 	}
 }
 
+func TestCalculateCrop(t *testing.T) {
+	tests := []struct {
+		gravity   Gravity
+		focal     *FocalPoint
+		left, top int
+	}{
+		{GravityCentre, nil, 50, 25},
+		{GravityNorth, nil, 50, 0},
+		{GravityEast, nil, 100, 25},
+		{GravitySouth, nil, 50, 50},
+		{GravityWest, nil, 0, 25},
+		{GravityNorthEast, nil, 100, 0},
+		{GravityNorthWest, nil, 0, 0},
+		{GravitySouthEast, nil, 100, 50},
+		{GravitySouthWest, nil, 0, 50},
+		{GravityCentre, &FocalPoint{0.5, 0.5}, 50, 25},
+		{GravityNorth, &FocalPoint{0.4, 0.6}, 30, 35},
+		{GravityCentre, &FocalPoint{0, 0}, 0, 0},
+		{GravityCentre, &FocalPoint{1, 1}, 100, 50},
+		{GravityCentre, &FocalPoint{0.9, 0.1}, 100, 0},
+	}
+
+	for _, tc := range tests {
+		left, top := calculateCrop(200, 100, 100, 50, tc.gravity, tc.focal)
+		if left != tc.left || top != tc.top {
+			t.Errorf("calculateCrop(%v, %v) = %d,%d, expected %d,%d", tc.gravity, tc.focal, left, top, tc.left, tc.top)
+		}
+	}
+}
+
+func TestCropWithFocalPoint(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+
+	tests := []Options{
+		{Width: 300, Height: 300, Crop: true, Gravity: GravitySouthEast},
+		{Width: 300, Height: 300, Crop: true, Gravity: GravityNorthWest},
+		{Width: 300, Height: 300, Crop: true, FocalPoint: &FocalPoint{0.2, 0.8}},
+		{Width: 300, Height: 300, Crop: true, Gravity: GravitySmart, FocalPoint: &FocalPoint{1, 0}},
+	}
+
+	for _, options := range tests {
+		newImg, err := Resize(buf, options)
+		if err != nil {
+			t.Fatalf("Resize(imgData, %#v) error: %#v", options, err)
+		}
+
+		if err := assertSize(newImg, options.Width, options.Height); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
 func TestIfBothSmartCropOptionsAreIdentical(t *testing.T) {
 	if !(VipsMajorVersion >= 8 && VipsMinorVersion > 4) {
 		t.Skipf("Skipping this test, libvips doesn't meet version requirement %s > 8.4", VipsVersion)
@@ -590,6 +868,857 @@ func TestIfBothSmartCropOptionsAreIdentical(t *testing.T) {
 	}
 }
 
+func TestEmbedCropKeepsSmartCrop(t *testing.T) {
+	if !(VipsMajorVersion >= 8 && VipsMinorVersion > 4) {
+		t.Skipf("Skipping this test, libvips doesn't meet version requirement %s > 8.4", VipsVersion)
+	}
+
+	buf, _ := Read("testdata/northern_cardinal_bird.jpg")
+
+	smartImg, err := Resize(buf, Options{Width: 100, Height: 100, Crop: true, Gravity: GravitySmart})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	embedImg, err := Resize(buf, Options{Width: 100, Height: 100, Embed: true, Crop: true, Gravity: GravitySmart})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cropImg, err := Resize(buf, Options{Width: 100, Height: 100, Embed: true, Crop: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sh, eh, ch := md5.Sum(smartImg), md5.Sum(embedImg), md5.Sum(cropImg)
+	if eh != sh {
+		t.Errorf("Expected embed and crop to keep the smart crop, %x != %x", eh, sh)
+	}
+	if eh == ch {
+		t.Error("Expected a different result from a standard crop")
+	}
+}
+
+func TestSmartCropStrategies(t *testing.T) {
+	if !(VipsMajorVersion >= 8 && VipsMinorVersion > 4) {
+		t.Skipf("Skipping this test, libvips doesn't meet version requirement %s > 8.4", VipsVersion)
+	}
+
+	buf, _ := Read("testdata/northern_cardinal_bird.jpg")
+
+	strategies := []SmartCropStrategy{
+		SmartCropAttention,
+		SmartCropEntropy,
+		SmartCropCentre,
+		SmartCropLow,
+		SmartCropHigh,
+	}
+
+	for _, strategy := range strategies {
+		options := Options{Width: 100, Height: 100, Crop: true, Gravity: GravitySmart, SmartCropStrategy: strategy}
+		newImg, result, err := ResizeWithResult(buf, options)
+		if err != nil {
+			t.Fatalf("ResizeWithResult(imgData, %#v) error: %#v", options, err)
+		}
+
+		if err := assertSize(newImg, 100, 100); err != nil {
+			t.Error(err)
+		}
+		if result.Width != 100 || result.Height != 100 {
+			t.Errorf("Invalid result size: %dx%d", result.Width, result.Height)
+		}
+
+		crop := result.SmartCrop
+		if crop == nil {
+			t.Fatalf("Missing smart crop result for strategy %d", strategy)
+		}
+		if crop.Box.Width != 100 || crop.Box.Height != 100 {
+			t.Errorf("Invalid crop box size: %#v", crop.Box)
+		}
+		if crop.Box.Left < 0 || crop.Box.Left+crop.Box.Width > crop.ImageSize.Width {
+			t.Errorf("Crop box %#v out of image bounds %#v", crop.Box, crop.ImageSize)
+		}
+
+		switch strategy {
+		case SmartCropAttention:
+			if VipsMajorVersion > 8 || (VipsMajorVersion == 8 && VipsMinorVersion >= 8) {
+				if !crop.HasAttention {
+					t.Error("Expected attention strategy to report the attention point")
+				}
+			}
+		case SmartCropEntropy, SmartCropCentre:
+			if crop.HasAttention {
+				t.Errorf("Unexpected attention point for strategy %d", strategy)
+			}
+		case SmartCropLow:
+			if crop.Box.Left != 0 {
+				t.Errorf("Expected low strategy to crop from the left, got %#v", crop.Box)
+			}
+		case SmartCropHigh:
+			if crop.Box.Left != crop.ImageSize.Width-100 {
+				t.Errorf("Expected high strategy to crop from the right, got %#v", crop.Box)
+			}
+		}
+	}
+}
+
+func TestSmartCropResultFocalPoint(t *testing.T) {
+	box := Rect{Left: 50, Top: 0, Width: 100, Height: 100}
+
+	r := newSmartCropResult(SmartCropResult{Box: box}, 200, 100)
+	if r.FocalPoint != (FocalPoint{0.5, 0.5}) {
+		t.Errorf("Expected box centre as focal point, got %#v", r.FocalPoint)
+	}
+
+	r = newSmartCropResult(SmartCropResult{Box: box, HasAttention: true, AttentionX: 150, AttentionY: 25}, 200, 100)
+	if r.FocalPoint != (FocalPoint{0.75, 0.25}) {
+		t.Errorf("Expected attention point as focal point, got %#v", r.FocalPoint)
+	}
+
+	r = newSmartCropResult(SmartCropResult{Box: box, HasAttention: true}, 200, 100)
+	if r.FocalPoint != (FocalPoint{0, 0}) {
+		t.Errorf("Expected attention point at the origin as focal point, got %#v", r.FocalPoint)
+	}
+}
+
+func TestResizeWithResultWithoutSmartCrop(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+
+	newImg, result, err := ResizeWithResult(buf, Options{Width: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size, _ := Size(newImg)
+	if result.Width != size.Width || result.Height != size.Height {
+		t.Errorf("Invalid result size: %dx%d != %dx%d", result.Width, result.Height, size.Width, size.Height)
+	}
+	if result.SmartCrop != nil {
+		t.Error("Expected no smart crop result")
+	}
+}
+
+func TestResizePaddingAndAspectRatio(t *testing.T) {
+	buf, _ := Read("testdata/test_square.jpg")
+
+	tests := []struct {
+		options       Options
+		width, height int
+		alpha         bool
+	}{
+		{Options{Padding: Padding{Top: 10, Right: 20, Bottom: 30, Left: 40}}, 1059, 1039, false},
+		{Options{AspectRatio: 16.0 / 9, Gravity: GravityWest, Extend: ExtendWhite}, 1776, 999, false},
+		{Options{AspectRatio: 0.5, Type: PNG, CanvasBackground: &ColorRGBA{255, 0, 0, 0}}, 999, 1998, true},
+		{Options{Width: 500, AspectRatio: 1, Padding: Padding{Left: 50}, Type: PNG, CanvasBackground: &ColorRGBA{A: 128}}, 550, 500, true},
+	}
+
+	for _, tc := range tests {
+		newImg, err := Resize(buf, tc.options)
+		if err != nil {
+			t.Fatalf("Resize(imgData, %#v) error: %#v", tc.options, err)
+		}
+
+		if err := assertSize(newImg, tc.width, tc.height); err != nil {
+			t.Error(err)
+		}
+
+		meta, _ := Metadata(newImg)
+		if meta.Alpha != tc.alpha {
+			t.Errorf("Expected alpha channel %t, got %t", tc.alpha, meta.Alpha)
+		}
+	}
+}
+
+func TestResizeInvalidPadding(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+
+	if _, err := Resize(buf, Options{Padding: Padding{Top: -1}}); err == nil {
+		t.Fatal("Expected error for negative padding")
+	}
+}
+
+func TestResizeCropAspect(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+
+	tests := []struct {
+		options       Options
+		width, height int
+	}{
+		{Options{CropAspect: 1}, 1050, 1050},
+		{Options{CropAspect: 0.8, Gravity: GravityEast}, 840, 1050},
+		{Options{CropAspect: 4, FocalPoint: &FocalPoint{0.5, 1}}, 1680, 420},
+		{Options{CropAspect: 1, Width: 800}, 500, 500},
+		{Options{CropAspect: 1680.0 / 1050}, 1680, 1050},
+	}
+
+	for _, tc := range tests {
+		newImg, err := Resize(buf, tc.options)
+		if err != nil {
+			t.Fatalf("Resize(imgData, %#v) error: %#v", tc.options, err)
+		}
+
+		if err := assertSize(newImg, tc.width, tc.height); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestResizeCropAspectSmartCrop(t *testing.T) {
+	if !(VipsMajorVersion >= 8 && VipsMinorVersion > 4) {
+		t.Skipf("Skipping this test, libvips doesn't meet version requirement %s > 8.4", VipsVersion)
+	}
+
+	buf, _ := Read("testdata/northern_cardinal_bird.jpg")
+
+	newImg, result, err := ResizeWithResult(buf, Options{CropAspect: 0.8, Gravity: GravitySmart})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := assertSize(newImg, 864, 1080); err != nil {
+		t.Error(err)
+	}
+	if result.SmartCrop == nil || result.SmartCrop.Box.Width != 864 {
+		t.Errorf("Invalid smart crop result: %#v", result.SmartCrop)
+	}
+}
+
+func TestCalculateAspectCrop(t *testing.T) {
+	tests := []struct {
+		width, height int
+		ratio         AspectRatio
+		expected      [2]int
+	}{
+		{1680, 1050, 1, [2]int{1050, 1050}},
+		{1050, 1680, 1, [2]int{1050, 1050}},
+		{1680, 1050, 0.8, [2]int{840, 1050}},
+		{1680, 1050, 16.0 / 9, [2]int{1680, 945}},
+		{100, 100, 1000, [2]int{100, 1}},
+	}
+
+	for _, tc := range tests {
+		width, height := calculateAspectCrop(tc.width, tc.height, tc.ratio)
+		if got := [2]int{width, height}; got != tc.expected {
+			t.Errorf("calculateAspectCrop(%d, %d, %v) = %v, expected %v", tc.width, tc.height, tc.ratio, got, tc.expected)
+		}
+	}
+}
+
+func TestResizeAffine(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+
+	tests := []struct {
+		options       Options
+		width, height int
+	}{
+		{Options{Affine: [4]float64{1, 0.2, 0, 1}, Extend: ExtendWhite}, 1890, 1050},
+		{Options{Affine: [4]float64{0, -1, 1, 0}}, 1050, 1680},
+		{Options{AffineTranslate: [2]float64{100, -50}, Extend: ExtendCopy}, 1680, 1050},
+		{Options{Affine: [4]float64{0.5, 0, 0, 0.5}, Width: 400}, 400, 250},
+	}
+
+	for _, tc := range tests {
+		newImg, err := Resize(buf, tc.options)
+		if err != nil {
+			t.Fatalf("Resize(imgData, %#v) error: %#v", tc.options, err)
+		}
+
+		if err := assertSize(newImg, tc.width, tc.height); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err := Resize(buf, Options{Affine: [4]float64{1, 2, 2, 4}}); err == nil {
+		t.Fatal("Expected error for a non invertible matrix")
+	}
+}
+
+func TestResizePerspective(t *testing.T) {
+	if !(VipsMajorVersion >= 8 && VipsMinorVersion >= 7) {
+		t.Skipf("Skipping this test, libvips doesn't meet version requirement %s >= 8.7", VipsVersion)
+	}
+
+	buf, _ := Read("testdata/test.jpg")
+	corners := [4]Point{{100, 50}, {1500, 120}, {1600, 1000}, {50, 900}}
+
+	tests := []struct {
+		options       Options
+		width, height int
+	}{
+		{Options{Perspective: &Perspective{Corners: corners, Width: 800, Height: 600}}, 800, 600},
+		{Options{Perspective: &Perspective{Corners: corners}}, 1553, 886},
+		{Options{Perspective: &Perspective{Corners: corners, Width: 800, Height: 600}, Width: 400}, 400, 300},
+	}
+
+	for _, tc := range tests {
+		newImg, err := Resize(buf, tc.options)
+		if err != nil {
+			t.Fatalf("Resize(imgData, %#v) error: %#v", tc.options, err)
+		}
+
+		if err := assertSize(newImg, tc.width, tc.height); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestCalculateAffineArea(t *testing.T) {
+	tests := []struct {
+		matrix   [4]float64
+		expected Rect
+	}{
+		{[4]float64{1, 0, 0, 1}, Rect{0, 0, 100, 50}},
+		{[4]float64{2, 0, 0, 0.5}, Rect{0, 0, 200, 25}},
+		{[4]float64{0, -1, 1, 0}, Rect{-50, 0, 50, 100}},
+		{[4]float64{1, 0.2, 0, 1}, Rect{0, 0, 110, 50}},
+	}
+
+	for _, tc := range tests {
+		if area := calculateAffineArea(100, 50, tc.matrix); area != tc.expected {
+			t.Errorf("calculateAffineArea(100, 50, %v) = %#v, expected %#v", tc.matrix, area, tc.expected)
+		}
+	}
+}
+
+func TestCalculateHomography(t *testing.T) {
+	corners := [4]Point{{10, 20}, {300, 5}, {320, 400}, {0, 380}}
+	targets := [4]Point{{0, 0}, {199, 0}, {199, 99}, {0, 99}}
+
+	m, err := calculateHomography(corners, 200, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, p := range targets {
+		w := m[6]*p.X + m[7]*p.Y + m[8]
+		x := (m[0]*p.X + m[1]*p.Y + m[2]) / w
+		y := (m[3]*p.X + m[4]*p.Y + m[5]) / w
+		if math.Abs(x-corners[i].X) > 1e-6 || math.Abs(y-corners[i].Y) > 1e-6 {
+			t.Errorf("Corner %d mapped to %v,%v, expected %#v", i, x, y, corners[i])
+		}
+	}
+
+	if width, height := calculatePerspectiveSize(corners); width != 321 || height != 396 {
+		t.Errorf("Invalid perspective size: %dx%d", width, height)
+	}
+
+	if _, err := calculateHomography([4]Point{}, 10, 10); err == nil {
+		t.Error("Expected error for degenerate corners")
+	}
+}
+
+func TestResizeMasks(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+	mask, _ := Read("testdata/transparent.png")
+
+	tests := []struct {
+		options       Options
+		width, height int
+		imageType     ImageType
+	}{
+		{Options{Width: 300, Height: 200, Crop: true, CornerRadius: 30}, 300, 200, PNG},
+		{Options{Width: 300, Height: 200, Crop: true, Circle: true}, 200, 200, PNG},
+		{Options{Width: 300, Height: 200, Crop: true, Mask: mask}, 300, 200, PNG},
+		{Options{Width: 300, Height: 200, Crop: true, CornerRadius: 500, Type: WEBP}, 300, 200, WEBP},
+	}
+
+	for _, tc := range tests {
+		newImg, err := Resize(buf, tc.options)
+		if err != nil {
+			t.Fatalf("Resize(imgData, %#v) error: %#v", tc.options, err)
+		}
+
+		if err := assertSize(newImg, tc.width, tc.height); err != nil {
+			t.Error(err)
+		}
+		if imageType := DetermineImageType(newImg); imageType != tc.imageType {
+			t.Errorf("Invalid image type: %s", ImageTypeName(imageType))
+		}
+
+		meta, _ := Metadata(newImg)
+		if !meta.Alpha {
+			t.Errorf("Expected alpha channel for %#v", tc.options)
+		}
+	}
+}
+
+func TestMaskTransparency(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+
+	tests := []Options{
+		{Width: 300, Height: 200, Crop: true, CornerRadius: 50},
+		{Width: 300, Height: 200, Crop: true, Circle: true},
+	}
+
+	for _, options := range tests {
+		img, err := ToImage(buf, options)
+		if err != nil {
+			t.Fatalf("ToImage(imgData, %#v) error: %#v", options, err)
+		}
+
+		bounds := img.Bounds()
+		if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+			t.Errorf("Expected transparent corner, got alpha %d", a)
+		}
+		if _, _, _, a := img.At(bounds.Dx()/2, bounds.Dy()/2).RGBA(); a != 0xffff {
+			t.Errorf("Expected opaque centre, got alpha %d", a)
+		}
+	}
+}
+
+func TestMaskBackground(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+	options := Options{Width: 300, Height: 200, Crop: true, CornerRadius: 50, Background: Color{255, 255, 255}}
+
+	img, err := ToImage(buf, options)
+	if err != nil {
+		t.Fatalf("ToImage(imgData, %#v) error: %#v", options, err)
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("Expected the mask not to be flattened, got alpha %d", a)
+	}
+
+	options.Type = JPEG
+	newImg, err := Resize(buf, options)
+	if err != nil {
+		t.Fatalf("Resize(imgData, %#v) error: %#v", options, err)
+	}
+	if imageType := DetermineImageType(newImg); imageType != JPEG {
+		t.Fatalf("Expected the requested type to be kept, got %s", ImageTypeName(imageType))
+	}
+
+	img, err = ToImage(newImg, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, b, _ := img.At(0, 0).RGBA(); r>>8 < 240 || g>>8 < 240 || b>>8 < 240 {
+		t.Errorf("Expected the corner to be flattened onto the background, got %d, %d, %d", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestResizeModulate(t *testing.T) {
+	red, err := NewCanvas(8, 8, ColorRGBA{200, 30, 30, 255}, PNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pixel := func(buf []byte, o Options) (uint32, uint32, uint32) {
+		img, err := ToImage(buf, o)
+		if err != nil {
+			t.Fatalf("Resize(imgData, %#v) error: %#v", o, err)
+		}
+		r, g, b, _ := img.At(4, 4).RGBA()
+		return r >> 8, g >> 8, b >> 8
+	}
+
+	r, g, b := pixel(red, Options{Modulate: &Modulate{Hue: 180}})
+	if r >= g || r >= b {
+		t.Errorf("Expected the hue to be rotated: %d, %d, %d", r, g, b)
+	}
+
+	r, g, b = pixel(red, Options{Modulate: &Modulate{Saturation: -1}})
+	if absDiff(r, g) > 2 || absDiff(r, b) > 2 {
+		t.Errorf("Expected the colour to be desaturated: %d, %d, %d", r, g, b)
+	}
+
+	r, _, _ = pixel(red, Options{Modulate: &Modulate{Brightness: -0.5, Lightness: -5}})
+	if r >= 150 {
+		t.Errorf("Expected the colour to be darker: %d", r)
+	}
+
+	r, g, b = pixel(red, Options{Modulate: &Modulate{Brightness: -1}})
+	if r > 2 || g > 2 || b > 2 {
+		t.Errorf("Expected the colour to be black: %d, %d, %d", r, g, b)
+	}
+
+	r, g, b = pixel(red, Options{Modulate: &Modulate{}})
+	if r < 198 || r > 202 || g < 28 || g > 32 || b < 28 || b > 32 {
+		t.Errorf("Expected the colour to be unchanged: %d, %d, %d", r, g, b)
+	}
+}
+
+func TestResizeModulateAlpha(t *testing.T) {
+	options := Options{Width: 100, Modulate: &Modulate{Saturation: 0.5, Hue: 90}}
+	buf, _ := Read("testdata/transparent.png")
+
+	newImg, err := Resize(buf, options)
+	if err != nil {
+		t.Fatalf("Resize(imgData, %#v) error: %#v", options, err)
+	}
+
+	meta, err := Metadata(newImg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.Alpha || meta.Type != "png" {
+		t.Fatalf("Expected the alpha channel to be preserved: %#v", meta)
+	}
+
+	_, err = Resize(buf, Options{Modulate: &Modulate{Saturation: -2}})
+	if err == nil {
+		t.Fatal("Expected error for negative saturation")
+	}
+
+	Write("testdata/test_modulate_out.png", newImg)
+}
+
+func TestResizeHistogramEffects(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+	washed, err := Resize(buf, Options{Width: 300, Contrast: 0.4, Brightness: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pixelRange := func(buf []byte) (byte, byte) {
+		raw, err := ExportRaw(buf, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		min, max := byte(255), byte(0)
+		for _, v := range raw.Pixels {
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+		return min, max
+	}
+
+	size, _ := Size(washed)
+	low, high := pixelRange(washed)
+	tests := []Options{
+		{Normalise: true},
+		{Normalise: true, NormaliseLower: 5, NormaliseUpper: 95},
+		{Normalise: true, NormaliseLower: 5},
+		{Normalise: true, NormaliseUpper: 95},
+		{Equalize: true},
+		{CLAHE: CLAHE{Width: 30, Height: 30, MaxSlope: 3}},
+	}
+
+	for _, options := range tests {
+		newImg, err := Resize(washed, options)
+		if err != nil {
+			t.Fatalf("Resize(imgData, %#v) error: %#v", options, err)
+		}
+
+		if err := assertSize(newImg, size.Width, size.Height); err != nil {
+			t.Error(err)
+		}
+
+		min, max := pixelRange(newImg)
+		if max-min <= high-low {
+			t.Errorf("Expected a wider range than %d-%d with %#v: %d-%d", low, high, options, min, max)
+		}
+	}
+}
+
+func TestResizeHistogramEffectsAlpha(t *testing.T) {
+	buf, _ := Read("testdata/transparent.png")
+
+	for _, options := range []Options{{Normalise: true}, {Equalize: true}, {CLAHE: CLAHE{Width: 20, Height: 20}}} {
+		newImg, err := Resize(buf, options)
+		if err != nil {
+			t.Fatalf("Resize(imgData, %#v) error: %#v", options, err)
+		}
+
+		meta, _ := Metadata(newImg)
+		if !meta.Alpha {
+			t.Fatalf("Expected the alpha channel to be preserved with %#v", options)
+		}
+	}
+}
+
+func TestResizeHistogramEffectsInvalid(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+
+	tests := []Options{
+		{Normalise: true, NormaliseLower: 60, NormaliseUpper: 40},
+		{Normalise: true, NormaliseUpper: 120},
+		{Normalise: true, NormaliseLower: 99.5},
+		{CLAHE: CLAHE{Width: 10, Height: 10, MaxSlope: -1}},
+		{CLAHE: CLAHE{Width: 10}},
+	}
+
+	for _, options := range tests {
+		if _, err := Resize(buf, options); err == nil {
+			t.Errorf("Expected error for %#v", options)
+		}
+	}
+}
+
+func TestResizeColorEffects(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+
+	tests := []struct {
+		name    string
+		options Options
+	}{
+		{"greyscale", Options{Greyscale: true}},
+		{"sepia", Options{Recomb: SepiaMatrix()}},
+		{"tint", Options{Tint: &Color{255, 120, 0}}},
+		{"duotone", Options{Duotone: &Duotone{Shadow: Color{20, 0, 80}, Highlight: Color{255, 220, 120}}}},
+		{"recomb4", Options{Recomb: [][]float64{{0, 0, 1, 0}, {0, 1, 0, 0}, {1, 0, 0, 0}, {0, 0, 0, 0.5}}, Type: PNG}},
+	}
+
+	for _, test := range tests {
+		test.options.Width = 300
+		newImg, err := Resize(buf, test.options)
+		if err != nil {
+			t.Fatalf("Resize(imgData, %#v) error: %#v", test.options, err)
+		}
+
+		meta, err := Metadata(newImg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.name == "greyscale" && meta.Space != "b-w" {
+			t.Errorf("Expected a greyscale image: %s", meta.Space)
+		}
+		if test.name == "recomb4" && !meta.Alpha {
+			t.Error("Expected an alpha channel")
+		}
+
+		Write("testdata/test_"+test.name+"_out."+meta.Type, newImg)
+	}
+}
+
+func TestResizeTint(t *testing.T) {
+	grey, err := NewCanvas(8, 8, ColorRGBA{128, 128, 128, 255}, PNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := ToImage(grey, Options{Tint: &Color{255, 0, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, g, b, _ := img.At(4, 4).RGBA()
+	if r>>8 <= g>>8+50 || r>>8 <= b>>8+50 {
+		t.Fatalf("Expected a red tint: %d, %d, %d", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestResizeGreyscaleOutput(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+
+	// A following tint brings the colours back
+	newImg, err := Resize(buf, Options{Width: 300, Greyscale: true, Tint: &Color{255, 0, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, _ := Metadata(newImg)
+	if meta.Space != "srgb" || meta.Channels != 3 {
+		t.Fatalf("Expected a colour image: %s, %d bands", meta.Space, meta.Channels)
+	}
+
+	// 16-bit images stay 16-bit
+	pixels := make([]byte, 8*8*3*2)
+	for i := range pixels {
+		pixels[i] = byte(i)
+	}
+	image, err := NewImageFromRaw(pixels, 8, 8, 3, BandFormatUshort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newImg, err = image.Process(Options{Greyscale: true, Type: PNG})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, _ = Metadata(newImg)
+	if meta.Space != "grey16" || meta.Channels != 1 {
+		t.Fatalf("Expected a 16-bit greyscale image: %s, %d bands", meta.Space, meta.Channels)
+	}
+}
+
+func TestResizeInvalidRecomb(t *testing.T) {
+	buf, _ := Read("testdata/test.jpg")
+
+	for _, matrix := range [][][]float64{{{1, 0}, {0, 1}}, {{1, 0, 0}, {0, 1}, {0, 0, 1}}} {
+		if _, err := Resize(buf, Options{Recomb: matrix}); err == nil {
+			t.Errorf("Expected error for %v", matrix)
+		}
+	}
+}
+
+func TestColorToLab(t *testing.T) {
+	tests := []struct {
+		color   Color
+		l, a, b float64
+	}{
+		{Color{255, 255, 255}, 100, 0, 0},
+		{Color{0, 0, 0}, 0, 0, 0},
+		{Color{255, 0, 0}, 53.24, 80.09, 67.20},
+		{Color{0, 0, 255}, 32.30, 79.19, -107.86},
+	}
+
+	for _, test := range tests {
+		l, a, b := colorToLab(test.color)
+		if math.Abs(l-test.l) > 0.1 || math.Abs(a-test.a) > 0.1 || math.Abs(b-test.b) > 0.1 {
+			t.Errorf("Invalid Lab colour for %v: %.2f, %.2f, %.2f", test.color, l, a, b)
+		}
+	}
+}
+
+func TestResizeComposite(t *testing.T) {
+	if !(VipsMajorVersion >= 8 && VipsMinorVersion >= 6) {
+		t.Skipf("Skipping this test, libvips doesn't meet version requirement %s >= 8.6", VipsVersion)
+	}
+
+	buf, _ := Read("testdata/test.jpg")
+	overlay, _ := Read("testdata/transparent.png")
+	layer, _ := Read("testdata/test.png")
+
+	options := Options{
+		Width: 800,
+		Composite: []Layer{
+			{Buf: overlay, Gravity: GravitySouthEast},
+			{Buf: layer, Left: 10, Top: 10, Absolute: true, Opacity: 0.5, Blend: BlendMultiply},
+			{Buf: overlay, Tile: true, Left: -50, Blend: BlendScreen},
+		},
+	}
+
+	newImg, err := Resize(buf, options)
+	if err != nil {
+		t.Fatalf("Resize(imgData, %#v) error: %#v", options, err)
+	}
+
+	if DetermineImageType(newImg) != JPEG {
+		t.Fatal("Image is not jpeg")
+	}
+	if err := assertSize(newImg, 800, 500); err != nil {
+		t.Error(err)
+	}
+
+	meta, _ := Metadata(newImg)
+	if meta.Alpha {
+		t.Error("Expected no alpha channel on an opaque image")
+	}
+
+	if _, err := Resize(buf, Options{Composite: []Layer{{Buf: overlay, Blend: BlendMode(100)}}}); err == nil {
+		t.Error("Expected error for an invalid blend mode")
+	}
+}
+
+func TestCompositePlacement(t *testing.T) {
+	if !(VipsMajorVersion >= 8 && VipsMinorVersion >= 6) {
+		t.Skipf("Skipping this test, libvips doesn't meet version requirement %s >= 8.6", VipsVersion)
+	}
+
+	red := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	for i := 0; i < len(red.Pix); i += 4 {
+		red.Pix[i], red.Pix[i+3] = 255, 255
+	}
+	layer, err := FromImage(red)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layerBuf, err := layer.Process(Options{Type: PNG})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, _ := Read("testdata/test.png")
+	img, err := ToImage(buf, Options{Composite: []Layer{{Buf: layerBuf, Gravity: GravitySouthEast}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bounds := img.Bounds()
+	if r, g, b, _ := img.At(bounds.Dx()-1, bounds.Dy()-1).RGBA(); r != 0xffff || g != 0 || b != 0 {
+		t.Errorf("Expected red bottom-right pixel, got %d,%d,%d", r, g, b)
+	}
+	if r, g, b, _ := img.At(bounds.Dx()-11, bounds.Dy()-11).RGBA(); r == 0xffff && g == 0 && b == 0 {
+		t.Error("Expected the layer to cover only the bottom-right corner")
+	}
+
+	img, err = ToImage(buf, Options{Composite: []Layer{{Buf: layerBuf, Absolute: true, Gravity: GravitySouthEast}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, b, _ := img.At(0, 0).RGBA(); r != 0xffff || g != 0 || b != 0 {
+		t.Errorf("Expected the layer at the origin, got %d,%d,%d", r, g, b)
+	}
+}
+
+func TestCalculateWatermarkPosition(t *testing.T) {
+	tests := []struct {
+		gravity   Gravity
+		margin    int
+		left, top int
+	}{
+		{GravityCentre, 10, 350, 250},
+		{GravityNorthWest, 10, 10, 10},
+		{GravityNorth, 10, 350, 10},
+		{GravityEast, 10, 690, 250},
+		{GravitySouthEast, 20, 680, 480},
+		{GravitySouthWest, 0, 0, 500},
+	}
+
+	for _, test := range tests {
+		left, top := calculateWatermarkPosition(100, 100, 800, 600, test.gravity, test.margin, 0, 0)
+		if left != test.left || top != test.top {
+			t.Errorf("Invalid position for gravity %d: %d,%d, expected %d,%d", test.gravity, left, top, test.left, test.top)
+		}
+	}
+}
+
+func TestCalculateCanvas(t *testing.T) {
+	tests := []struct {
+		width, height int
+		ratio         AspectRatio
+		padding       Padding
+		gravity       Gravity
+		expected      [4]int
+	}{
+		{100, 100, 0, Padding{1, 2, 3, 4}, GravityCentre, [4]int{4, 1, 106, 104}},
+		{90, 100, 16.0 / 9, Padding{}, GravityCentre, [4]int{44, 0, 178, 100}},
+		{90, 100, 16.0 / 9, Padding{}, GravityWest, [4]int{0, 0, 178, 100}},
+		{90, 100, 16.0 / 9, Padding{}, GravityEast, [4]int{88, 0, 178, 100}},
+		{200, 100, 1, Padding{}, GravitySouth, [4]int{0, 100, 200, 200}},
+		{200, 100, 1, Padding{Top: 10, Left: 5}, GravityNorthWest, [4]int{5, 10, 205, 210}},
+		{200, 100, 2, Padding{}, GravitySouthEast, [4]int{0, 0, 200, 100}},
+	}
+
+	for _, tc := range tests {
+		left, top, width, height := calculateCanvas(tc.width, tc.height, tc.ratio, tc.padding, tc.gravity)
+		if got := [4]int{left, top, width, height}; got != tc.expected {
+			t.Errorf("calculateCanvas(%d, %d, %v, %#v, %d) = %v, expected %v",
+				tc.width, tc.height, tc.ratio, tc.padding, tc.gravity, got, tc.expected)
+		}
+	}
+}
+
+func TestParseAspectRatio(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected AspectRatio
+	}{
+		{"16:9", 16.0 / 9},
+		{"4:5", 0.8},
+		{" 1 : 1 ", 1},
+		{"1.5", 1.5},
+	}
+
+	for _, tc := range tests {
+		ratio, err := ParseAspectRatio(tc.value)
+		if err != nil {
+			t.Fatalf("ParseAspectRatio(%q) error: %s", tc.value, err)
+		}
+		if ratio != tc.expected {
+			t.Errorf("ParseAspectRatio(%q) = %v, expected %v", tc.value, ratio, tc.expected)
+		}
+	}
+
+	for _, value := range []string{"", "foo", "16:0", "0", "-1", "1:2:3"} {
+		if _, err := ParseAspectRatio(value); err == nil {
+			t.Errorf("Expected error for aspect ratio %q", value)
+		}
+	}
+}
+
 func TestSkipCropIfTooSmall(t *testing.T) {
 	testCases := []struct {
 		name    string
@@ -0,0 +1,345 @@
+package bimg
+
+/*
+#cgo pkg-config: vips
+#include "vips/vips.h"
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Sprite represents a sprite sheet built by BuildSprite.
+type Sprite struct {
+	// Image is the encoded sheet.
+	Image  []byte
+	Width  int
+	Height int
+	// Rects is the area of each image in the sheet, by name.
+	Rects map[string]Rect
+}
+
+// spriteItem is an image to pack, with its position once packed.
+type spriteItem struct {
+	name          string
+	left, top     int
+	width, height int
+}
+
+// BuildSprite packs the given images into a single sheet, returning it
+// along with the area of each image, by name.
+func BuildSprite(images map[string][]byte, o SpriteOptions) (Sprite, error) {
+	defer C.vips_thread_shutdown()
+
+	if len(images) == 0 {
+		return Sprite{}, errors.New("No images to pack")
+	}
+	if o.MaxWidth < 0 || o.Spacing < 0 {
+		return Sprite{}, errors.New("Sprite options cannot be negative")
+	}
+
+	// Defaults
+	if o.Quality == 0 {
+		o.Quality = Quality
+	}
+
+	names := make([]string, 0, len(images))
+	for name := range images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	loaded := make(map[string]*C.VipsImage, len(images))
+	release := func() {
+		for _, image := range loaded {
+			C.g_object_unref(C.gpointer(image))
+		}
+	}
+
+	items := make([]spriteItem, 0, len(names))
+	for _, name := range names {
+		buf := images[name]
+		image, imageType, err := loadImage(buf)
+		if err == nil {
+			image, err = processImage(image, imageType, buf, applyDefaults(Options{}, imageType))
+		}
+		if err != nil {
+			release()
+			return Sprite{}, fmt.Errorf("Cannot load sprite %q: %s", name, err)
+		}
+		loaded[name] = image
+		items = append(items, spriteItem{name: name, width: int(image.Xsize), height: int(image.Ysize)})
+	}
+
+	width, height, err := packSprites(items, o)
+	if err != nil {
+		release()
+		return Sprite{}, err
+	}
+	if width > maxSize || height > maxSize {
+		release()
+		return Sprite{}, errors.New("Maximum image size exceeded")
+	}
+
+	sheet, err := vipsCanvas(width, height, o.Background)
+	if err != nil {
+		release()
+		return Sprite{}, err
+	}
+
+	sprite := Sprite{Width: width, Height: height, Rects: make(map[string]Rect, len(items))}
+	layers := make([]*C.VipsImage, len(items))
+	left := make([]int, len(items))
+	top := make([]int, len(items))
+	for i, item := range items {
+		layers[i], left[i], top[i] = loaded[item.name], item.left, item.top
+		sprite.Rects[item.name] = Rect{Left: item.left, Top: item.top, Width: item.width, Height: item.height}
+	}
+
+	sheet, err = vipsSprite(sheet, layers, left, top, o.Background)
+	if err != nil {
+		return Sprite{}, err
+	}
+
+	sprite.Image, err = saveNewImage(sheet, o.Type, o.Quality)
+	if err != nil {
+		return Sprite{}, err
+	}
+
+	return sprite, nil
+}
+
+// CSS returns the CSS rules showing each image of the sheet as background of
+// the elements of class prefix-name, where url is the location of the sheet.
+// Image names must be valid CSS identifiers.
+func (s Sprite) CSS(prefix, url string) string {
+	var css bytes.Buffer
+
+	fmt.Fprintf(&css, ".%s {\n  background-image: url(%q);\n  background-repeat: no-repeat;\n}\n", prefix, url)
+	for _, name := range s.names() {
+		r := s.Rects[name]
+		fmt.Fprintf(&css, ".%s-%s {\n  background-position: %dpx %dpx;\n  width: %dpx;\n  height: %dpx;\n}\n",
+			prefix, name, -r.Left, -r.Top, r.Width, r.Height)
+	}
+
+	return css.String()
+}
+
+// JSON returns the size of the sheet and the area of each image as JSON.
+func (s Sprite) JSON() ([]byte, error) {
+	type rect struct {
+		Left   int `json:"left"`
+		Top    int `json:"top"`
+		Width  int `json:"width"`
+		Height int `json:"height"`
+	}
+	sheet := struct {
+		Width   int             `json:"width"`
+		Height  int             `json:"height"`
+		Sprites map[string]rect `json:"sprites"`
+	}{s.Width, s.Height, make(map[string]rect, len(s.Rects))}
+
+	for name, r := range s.Rects {
+		sheet.Sprites[name] = rect{r.Left, r.Top, r.Width, r.Height}
+	}
+
+	return json.Marshal(sheet)
+}
+
+func (s Sprite) names() []string {
+	names := make([]string, 0, len(s.Rects))
+	for name := range s.Rects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// packSprites positions the items and returns the size of the sheet.
+func packSprites(items []spriteItem, o SpriteOptions) (int, int, error) {
+	// Pack the images with their spacing, which is then removed from the
+	// right and bottom edges of the sheet
+	widest, area := 0, 0
+	for _, item := range items {
+		if item.width+o.Spacing > widest {
+			widest = item.width + o.Spacing
+		}
+		area += (item.width + o.Spacing) * (item.height + o.Spacing)
+	}
+
+	binWidth := o.MaxWidth
+	if binWidth == 0 {
+		binWidth = int(math.Ceil(math.Sqrt(float64(area))))
+		if binWidth < widest {
+			binWidth = widest
+		}
+	} else {
+		binWidth += o.Spacing
+		if binWidth < widest {
+			return 0, 0, errors.New("Sprite images are wider than the maximum width")
+		}
+	}
+
+	switch o.Packing {
+	case SpritePackingShelf:
+		packShelves(items, binWidth, o.Spacing)
+	case SpritePackingMaxRects:
+		if err := packMaxRects(items, binWidth, o.Spacing); err != nil {
+			return 0, 0, err
+		}
+	default:
+		return 0, 0, errors.New("Invalid sprite packing")
+	}
+
+	width, height := 0, 0
+	for _, item := range items {
+		if item.left+item.width > width {
+			width = item.left + item.width
+		}
+		if item.top+item.height > height {
+			height = item.top + item.height
+		}
+	}
+
+	return width, height, nil
+}
+
+// spriteOrder sorts the indexes of the items by decreasing size.
+type spriteOrder struct {
+	indexes []int
+	items   []spriteItem
+	size    func(spriteItem) int
+}
+
+func (s spriteOrder) Len() int {
+	return len(s.indexes)
+}
+
+func (s spriteOrder) Less(a, b int) bool {
+	return s.size(s.items[s.indexes[a]]) > s.size(s.items[s.indexes[b]])
+}
+
+func (s spriteOrder) Swap(a, b int) {
+	s.indexes[a], s.indexes[b] = s.indexes[b], s.indexes[a]
+}
+
+// spritesOrder returns the indexes of the items from the largest to the
+// smallest, as measured by size, keeping equal ones in order.
+func spritesOrder(items []spriteItem, size func(spriteItem) int) []int {
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Stable(spriteOrder{order, items, size})
+	return order
+}
+
+// packShelves places the items in rows, from the tallest to the shortest.
+func packShelves(items []spriteItem, binWidth, spacing int) {
+	order := spritesOrder(items, func(item spriteItem) int {
+		return item.height
+	})
+
+	x, y, shelfHeight := 0, 0, 0
+	for _, i := range order {
+		width, height := items[i].width+spacing, items[i].height+spacing
+		if x+width > binWidth {
+			x, y, shelfHeight = 0, y+shelfHeight, 0
+		}
+		items[i].left, items[i].top = x, y
+		x += width
+		if height > shelfHeight {
+			shelfHeight = height
+		}
+	}
+}
+
+// packMaxRects places the items, from the largest to the smallest, in the
+// free area closest to the top left corner, keeping track of all the
+// maximal free rectangles of a sheet of unbounded height.
+func packMaxRects(items []spriteItem, binWidth, spacing int) error {
+	order := spritesOrder(items, func(item spriteItem) int {
+		return item.width * item.height
+	})
+
+	// Stacking all the items is the highest the sheet can be
+	binHeight := 0
+	for _, item := range items {
+		binHeight += item.height + spacing
+	}
+
+	free := []Rect{{Left: 0, Top: 0, Width: binWidth, Height: binHeight}}
+	for _, i := range order {
+		width, height := items[i].width+spacing, items[i].height+spacing
+
+		best := -1
+		for j, r := range free {
+			if r.Width < width || r.Height < height {
+				continue
+			}
+			if best < 0 || r.Top < free[best].Top || (r.Top == free[best].Top && r.Left < free[best].Left) {
+				best = j
+			}
+		}
+		if best < 0 {
+			return fmt.Errorf("Cannot fit sprite %q in the sheet", items[i].name)
+		}
+
+		placed := Rect{Left: free[best].Left, Top: free[best].Top, Width: width, Height: height}
+		items[i].left, items[i].top = placed.Left, placed.Top
+		free = splitFreeRects(free, placed)
+	}
+
+	return nil
+}
+
+// splitFreeRects removes the placed area from the free rectangles, replacing
+// each one it overlaps with the up to four maximal rectangles around it.
+func splitFreeRects(free []Rect, placed Rect) []Rect {
+	var next []Rect
+	for _, r := range free {
+		if placed.Left >= r.Left+r.Width || placed.Left+placed.Width <= r.Left ||
+			placed.Top >= r.Top+r.Height || placed.Top+placed.Height <= r.Top {
+			next = append(next, r)
+			continue
+		}
+
+		if placed.Left > r.Left {
+			next = append(next, Rect{r.Left, r.Top, placed.Left - r.Left, r.Height})
+		}
+		if right := placed.Left + placed.Width; right < r.Left+r.Width {
+			next = append(next, Rect{right, r.Top, r.Left + r.Width - right, r.Height})
+		}
+		if placed.Top > r.Top {
+			next = append(next, Rect{r.Left, r.Top, r.Width, placed.Top - r.Top})
+		}
+		if bottom := placed.Top + placed.Height; bottom < r.Top+r.Height {
+			next = append(next, Rect{r.Left, bottom, r.Width, r.Top + r.Height - bottom})
+		}
+	}
+
+	// Drop the rectangles contained in another one
+	var pruned []Rect
+	for i, r := range next {
+		contained := false
+		for j, other := range next {
+			if i != j && r.Left >= other.Left && r.Top >= other.Top &&
+				r.Left+r.Width <= other.Left+other.Width && r.Top+r.Height <= other.Top+other.Height &&
+				(r != other || i > j) {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			pruned = append(pruned, r)
+		}
+	}
+
+	return pruned
+}
@@ -0,0 +1,156 @@
+package bimg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBuildSprite(t *testing.T) {
+	icons := map[string][]byte{}
+	for i, color := range []ColorRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 128}} {
+		buf, err := NewCanvas(16+i*16, 48-i*8, color, PNG)
+		if err != nil {
+			t.Fatal(err)
+		}
+		icons[fmt.Sprintf("icon%d", i)] = buf
+	}
+	icons["photo"] = readFile("test.png")
+
+	for _, packing := range []SpritePacking{SpritePackingShelf, SpritePackingMaxRects} {
+		sprite, err := BuildSprite(icons, SpriteOptions{Packing: packing, Spacing: 2})
+		if err != nil {
+			t.Fatalf("Cannot build the sprite: %s", err)
+		}
+
+		if err := assertSize(sprite.Image, sprite.Width, sprite.Height); err != nil {
+			t.Error(err)
+		}
+		if len(sprite.Rects) != len(icons) {
+			t.Fatalf("Invalid number of sprites: %d", len(sprite.Rects))
+		}
+		if r := sprite.Rects["photo"]; r.Width != 400 || r.Height != 300 {
+			t.Fatalf("Invalid sprite size: %#v", r)
+		}
+
+		img, err := ToImage(sprite.Image, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := sprite.Rects["icon1"]
+		if red, green, _, _ := img.At(r.Left+r.Width/2, r.Top+r.Height/2).RGBA(); red != 0 || green>>8 != 255 {
+			t.Fatalf("Invalid sprite colour at %#v", r)
+		}
+
+		Write(fmt.Sprintf("testdata/test_sprite_%d_out.png", packing), sprite.Image)
+	}
+}
+
+func TestBuildSpriteInvalid(t *testing.T) {
+	if _, err := BuildSprite(nil, SpriteOptions{}); err == nil {
+		t.Fatal("Expected error for empty sprite")
+	}
+	if _, err := BuildSprite(map[string][]byte{"a": []byte("invalid")}, SpriteOptions{}); err == nil {
+		t.Fatal("Expected error for invalid image")
+	}
+	if _, err := BuildSprite(map[string][]byte{"a": readFile("test.png")}, SpriteOptions{MaxWidth: 100}); err == nil {
+		t.Fatal("Expected error for too narrow sprite")
+	}
+}
+
+func TestPackSprites(t *testing.T) {
+	sizes := [][2]int{{10, 40}, {30, 10}, {20, 20}, {50, 5}, {5, 5}, {25, 35}, {40, 15}}
+
+	for _, packing := range []SpritePacking{SpritePackingShelf, SpritePackingMaxRects} {
+		for _, spacing := range []int{0, 3} {
+			items := make([]spriteItem, len(sizes))
+			for i, size := range sizes {
+				items[i] = spriteItem{name: fmt.Sprint(i), width: size[0], height: size[1]}
+			}
+
+			width, height, err := packSprites(items, SpriteOptions{Packing: packing, Spacing: spacing, MaxWidth: 60})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if width > 60 {
+				t.Errorf("Sheet wider than the maximum width: %d", width)
+			}
+
+			for i, a := range items {
+				if a.left < 0 || a.top < 0 || a.left+a.width > width || a.top+a.height > height {
+					t.Errorf("Sprite %d out of the sheet: %#v", i, a)
+				}
+				for j, b := range items[i+1:] {
+					if a.left < b.left+b.width+spacing && b.left < a.left+a.width+spacing &&
+						a.top < b.top+b.height+spacing && b.top < a.top+a.height+spacing {
+						t.Errorf("Sprites %d and %d overlap with packing %d: %#v, %#v", i, i+1+j, packing, a, b)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPackMaxRectsTooWide(t *testing.T) {
+	items := []spriteItem{{name: "wide", width: 50, height: 10}}
+	if err := packMaxRects(items, 40, 0); err == nil {
+		t.Fatal("Expected error for a sprite wider than the sheet")
+	}
+}
+
+func TestBuildSpriteBackground(t *testing.T) {
+	icon, err := NewCanvas(16, 16, ColorRGBA{0, 0, 255, 128}, PNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sprite, err := BuildSprite(map[string][]byte{"icon": icon}, SpriteOptions{Background: ColorRGBA{255, 255, 255, 255}})
+	if err != nil {
+		t.Fatalf("Cannot build the sprite: %s", err)
+	}
+
+	img, err := ToImage(sprite.Image, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The translucent icon is flattened onto the opaque sheet
+	r, g, b, a := img.At(8, 8).RGBA()
+	if absDiff(r>>8, 127) > 2 || absDiff(g>>8, 127) > 2 || b>>8 != 255 || a>>8 != 255 {
+		t.Fatalf("Invalid sprite colour: %d, %d, %d, %d", r>>8, g>>8, b>>8, a>>8)
+	}
+}
+
+func TestSpriteExport(t *testing.T) {
+	sprite := Sprite{
+		Width:  48,
+		Height: 16,
+		Rects: map[string]Rect{
+			"home":   {0, 0, 16, 16},
+			"search": {16, 0, 32, 16},
+		},
+	}
+
+	css := sprite.CSS("icon", "sprite.png")
+	if !strings.Contains(css, `background-image: url("sprite.png");`) ||
+		!strings.Contains(css, ".icon-search {\n  background-position: -16px 0px;\n  width: 32px;\n  height: 16px;\n}") {
+		t.Fatalf("Invalid CSS: %s", css)
+	}
+
+	buf, err := sprite.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sheet struct {
+		Width   int
+		Sprites map[string]map[string]int
+	}
+	if err := json.Unmarshal(buf, &sheet); err != nil {
+		t.Fatal(err)
+	}
+	if sheet.Width != 48 || sheet.Sprites["search"]["left"] != 16 || sheet.Sprites["search"]["width"] != 32 {
+		t.Fatalf("Invalid JSON: %s", buf)
+	}
+}
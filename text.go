@@ -0,0 +1,170 @@
+package bimg
+
+/*
+#cgo pkg-config: vips
+#include "vips/vips.h"
+*/
+import "C"
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var markupEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// MeasureText returns the size of the given text once rendered,
+// without drawing it on any image.
+func MeasureText(o TextOptions) (ImageSize, error) {
+	defer C.vips_thread_shutdown()
+
+	if o.Text == "" {
+		return ImageSize{}, nil
+	}
+	if o.Font == "" {
+		o.Font = WatermarkFont
+	}
+
+	width, height, err := vipsMeasureText(o)
+	if err != nil {
+		return ImageSize{}, err
+	}
+
+	return ImageSize{Width: width, Height: height}, nil
+}
+
+// RenderText renders the given text as a standalone image, such as a caption
+// or a placeholder. The encoded image can also be composited with Layer.
+func RenderText(o TextOptions) ([]byte, error) {
+	defer C.vips_thread_shutdown()
+
+	if o.Text == "" {
+		return nil, errors.New("Text cannot be empty")
+	}
+	if o.Height > 0 && o.Width == 0 {
+		return nil, errors.New("Text autofit requires a width")
+	}
+	if o.Padding < 0 {
+		return nil, errors.New("Text padding cannot be negative")
+	}
+
+	// Defaults
+	if o.Font == "" {
+		o.Font = WatermarkFont
+	}
+	if o.Color == nil {
+		o.Color = &ColorRGBA{0, 0, 0, 255}
+	}
+	if o.Quality == 0 {
+		o.Quality = Quality
+	}
+
+	// A transparent box keeps the padding when there is no background
+	box := o.Background
+	if box == nil && o.Padding > 0 {
+		box = &ColorRGBA{}
+	}
+
+	image, err := vipsTextLayer(o, *o.Color, box, o.Padding, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return saveNewImage(image, o.Type, o.Quality)
+}
+
+func watermarkTextOptions(w Watermark) TextOptions {
+	return TextOptions{
+		Text:     w.Text,
+		Font:     w.Font,
+		FontFile: w.FontFile,
+		FontData: w.FontData,
+		Markup:   w.Markup,
+		Width:    w.Width,
+		DPI:      w.DPI,
+		Align:    w.Align,
+		Justify:  w.Justify,
+	}
+}
+
+// textMarkup returns the text as Pango markup, escaping it unless
+// it is markup already.
+func textMarkup(o TextOptions) string {
+	if o.Markup {
+		return o.Text
+	}
+	return markupEscaper.Replace(o.Text)
+}
+
+// colorSpan wraps the markup in a span of the given colour.
+func colorSpan(markup string, c ColorRGBA) string {
+	// Pango alpha values range from 1 to 65536
+	alpha := int(c.A)*257 + 1
+	return fmt.Sprintf(`<span foreground="#%02x%02x%02x" fgalpha="%d">%s</span>`, c.R, c.G, c.B, alpha, markup)
+}
+
+// fontFiles stores the in-memory fonts written to disk, by content, in a
+// temporary directory which Shutdown removes. libvips registers each font
+// file only once, so they are kept for the lifetime of the process.
+var fontFiles struct {
+	sync.Mutex
+	dir   string
+	paths map[string]string
+}
+
+// textFontFile returns the path of the font file to render the text with,
+// writing in-memory fonts to the temporary directory.
+func textFontFile(o TextOptions) (string, error) {
+	if len(o.FontData) == 0 {
+		return o.FontFile, nil
+	}
+
+	sum := sha256.Sum256(o.FontData)
+	name := hex.EncodeToString(sum[:])
+
+	fontFiles.Lock()
+	defer fontFiles.Unlock()
+
+	if path, ok := fontFiles.paths[name]; ok {
+		return path, nil
+	}
+
+	if fontFiles.dir == "" {
+		dir, err := ioutil.TempDir("", "bimg-fonts-")
+		if err != nil {
+			return "", err
+		}
+		fontFiles.dir = dir
+		fontFiles.paths = make(map[string]string)
+	}
+
+	path := filepath.Join(fontFiles.dir, name)
+	if err := ioutil.WriteFile(path, o.FontData, 0600); err != nil {
+		return "", err
+	}
+	fontFiles.paths[name] = path
+
+	return path, nil
+}
+
+// removeFontFiles removes the font files written by textFontFile.
+func removeFontFiles() error {
+	fontFiles.Lock()
+	defer fontFiles.Unlock()
+
+	if fontFiles.dir == "" {
+		return nil
+	}
+
+	err := os.RemoveAll(fontFiles.dir)
+	fontFiles.dir = ""
+	fontFiles.paths = nil
+	return err
+}
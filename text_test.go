@@ -0,0 +1,196 @@
+package bimg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestMeasureText(t *testing.T) {
+	size, err := MeasureText(TextOptions{Text: "Hello world", DPI: 72})
+	if err != nil {
+		t.Fatalf("Cannot measure the text: %s", err)
+	}
+	if size.Width <= 0 || size.Height <= 0 {
+		t.Fatalf("Invalid text size: %dx%d", size.Width, size.Height)
+	}
+
+	larger, err := MeasureText(TextOptions{Text: "Hello world", DPI: 144})
+	if err != nil {
+		t.Fatalf("Cannot measure the text: %s", err)
+	}
+	if larger.Width <= size.Width || larger.Height <= size.Height {
+		t.Fatalf("Expected larger text at higher DPI: %dx%d, %dx%d", size.Width, size.Height, larger.Width, larger.Height)
+	}
+
+	wrapped, err := MeasureText(TextOptions{Text: "Hello world", DPI: 144, Width: larger.Width / 2, Align: TextAlignRight})
+	if err != nil {
+		t.Fatalf("Cannot measure the text: %s", err)
+	}
+	if wrapped.Width > larger.Width/2 || wrapped.Height <= larger.Height {
+		t.Fatalf("Expected text to be wrapped: %dx%d", wrapped.Width, wrapped.Height)
+	}
+}
+
+func TestMeasureTextEscaping(t *testing.T) {
+	_, err := MeasureText(TextOptions{Text: "Fish & <chips>"})
+	if err != nil {
+		t.Fatalf("Cannot measure plain text: %s", err)
+	}
+
+	_, err = MeasureText(TextOptions{Text: "Fish & <chips>", Markup: true})
+	if err == nil {
+		t.Fatal("Expected invalid markup error")
+	}
+}
+
+func TestMeasureTextInvalidAlign(t *testing.T) {
+	_, err := MeasureText(TextOptions{Text: "Hello", Align: TextAlign(10)})
+	if err == nil {
+		t.Fatal("Expected invalid alignment error")
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	o := TextOptions{Text: "Hello world", DPI: 100, Padding: 10}
+	size, err := MeasureText(o)
+	if err != nil {
+		t.Fatalf("Cannot measure the text: %s", err)
+	}
+
+	buf, err := RenderText(o)
+	if err != nil {
+		t.Fatalf("Cannot render the text: %s", err)
+	}
+
+	if DetermineImageType(buf) != PNG {
+		t.Fatal("Image is not png")
+	}
+	if err := assertSize(buf, size.Width+20, size.Height+20); err != nil {
+		t.Error(err)
+	}
+
+	meta, _ := Metadata(buf)
+	if !meta.Alpha {
+		t.Fatal("Expected a transparent background")
+	}
+	if len(buf) > meta.Size.Width*meta.Size.Height*4/2 {
+		t.Errorf("Expected a compressed image, got %d bytes", len(buf))
+	}
+
+	Write("testdata/test_render_text_out.png", buf)
+}
+
+func TestRenderTextBackground(t *testing.T) {
+	buf, err := RenderText(TextOptions{
+		Text:       "Caption",
+		Color:      &ColorRGBA{255, 255, 255, 255},
+		Background: &ColorRGBA{200, 0, 0, 255},
+		Padding:    5,
+		Type:       JPEG,
+	})
+	if err != nil {
+		t.Fatalf("Cannot render the text: %s", err)
+	}
+
+	if DetermineImageType(buf) != JPEG {
+		t.Fatal("Image is not jpeg")
+	}
+
+	Write("testdata/test_render_text_background_out.jpg", buf)
+}
+
+func TestRenderTextAutofit(t *testing.T) {
+	if !(VipsMajorVersion >= 8 && VipsMinorVersion >= 12) {
+		t.Skipf("Skipping this test, libvips doesn't meet version requirement %s >= 8.12", VipsVersion)
+	}
+
+	buf, err := RenderText(TextOptions{Text: "Fit me in the box", Width: 300, Height: 100})
+	if err != nil {
+		t.Fatalf("Cannot render the text: %s", err)
+	}
+
+	size, err := Size(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size.Width > 300 || size.Height > 100 {
+		t.Fatalf("Text does not fit the box: %dx%d", size.Width, size.Height)
+	}
+	if size.Width < 150 && size.Height < 50 {
+		t.Fatalf("Text does not fill the box: %dx%d", size.Width, size.Height)
+	}
+
+	// The text grows along with the box, whatever the DPI
+	large, err := RenderText(TextOptions{Text: "Fit me in the box", Width: 900, Height: 300, DPI: 72})
+	if err != nil {
+		t.Fatalf("Cannot render the text: %s", err)
+	}
+	largeSize, err := Size(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if largeSize.Height < size.Height*2 {
+		t.Fatalf("Text does not scale with the box: %dx%d, then %dx%d", size.Width, size.Height, largeSize.Width, largeSize.Height)
+	}
+}
+
+func TestRenderTextInvalid(t *testing.T) {
+	tests := []TextOptions{
+		{},
+		{Text: "Hello", Height: 100},
+		{Text: "Hello", Padding: -1},
+	}
+
+	for _, o := range tests {
+		if _, err := RenderText(o); err == nil {
+			t.Errorf("Expected error for %#v", o)
+		}
+	}
+}
+
+func TestTextMarkup(t *testing.T) {
+	if markup := textMarkup(TextOptions{Text: "a & <b>"}); markup != "a &amp; &lt;b&gt;" {
+		t.Fatalf("Invalid escaped text: %s", markup)
+	}
+	if markup := textMarkup(TextOptions{Text: "<b>a</b>", Markup: true}); markup != "<b>a</b>" {
+		t.Fatalf("Invalid markup: %s", markup)
+	}
+
+	span := colorSpan("a", ColorRGBA{255, 0, 16, 255})
+	if span != `<span foreground="#ff0010" fgalpha="65536">a</span>` {
+		t.Fatalf("Invalid colour span: %s", span)
+	}
+}
+
+func TestTextFontFile(t *testing.T) {
+	path, err := textFontFile(TextOptions{FontFile: "/fonts/font.ttf"})
+	if err != nil || path != "/fonts/font.ttf" {
+		t.Fatalf("Invalid font file: %s, %v", path, err)
+	}
+
+	data := []byte("not really a font")
+	path, err = textFontFile(TextOptions{FontFile: "/fonts/font.ttf", FontData: data})
+	defer removeFontFiles()
+	if err != nil {
+		t.Fatalf("Cannot write the font data: %s", err)
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil || !bytes.Equal(buf, data) {
+		t.Fatalf("Invalid font file content: %v", err)
+	}
+
+	again, err := textFontFile(TextOptions{FontData: data})
+	if err != nil || again != path {
+		t.Fatalf("Expected the font file to be reused: %s, %s", path, again)
+	}
+
+	if err := removeFontFiles(); err != nil {
+		t.Fatalf("Cannot remove the font files: %s", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected the font file to be removed: %v", err)
+	}
+}
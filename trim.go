@@ -0,0 +1,56 @@
+package bimg
+
+/*
+#cgo pkg-config: vips
+#include "vips/vips.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"runtime"
+)
+
+// FindTrim returns the area of the given image buffer which Trim would keep,
+// removing the borders which are within threshold of the background colour.
+// Coordinates refer to the image once auto-rotated based on its EXIF orientation.
+func FindTrim(buf []byte, background Color, threshold float64) (Rect, error) {
+	return findTrim(buf, func(image *C.VipsImage) (int, int, int, int, error) {
+		return vipsTrim(image, background, threshold)
+	})
+}
+
+// FindTrimAlpha returns the area of the given image buffer which Trim would
+// keep with TrimAlpha, removing the borders whose alpha is within threshold
+// of fully transparent. Images without alpha channel are kept whole.
+func FindTrimAlpha(buf []byte, threshold float64) (Rect, error) {
+	return findTrim(buf, func(image *C.VipsImage) (int, int, int, int, error) {
+		return vipsTrimAlpha(image, threshold)
+	})
+}
+
+func findTrim(buf []byte, trim func(*C.VipsImage) (int, int, int, int, error)) (Rect, error) {
+	defer C.vips_thread_shutdown()
+	defer runtime.KeepAlive(buf)
+
+	if !(VipsMajorVersion > 8 || (VipsMajorVersion == 8 && VipsMinorVersion >= 6)) {
+		return Rect{}, errors.New("Trim requires libvips 8.6+")
+	}
+
+	image, _, err := loadImage(buf)
+	if err != nil {
+		return Rect{}, err
+	}
+
+	image, _, err = rotateAndFlipImage(image, Options{})
+	if err != nil {
+		return Rect{}, err
+	}
+
+	left, top, width, height, err := trim(image)
+	if err != nil {
+		return Rect{}, err
+	}
+
+	return Rect{Left: left, Top: top, Width: width, Height: height}, nil
+}
@@ -0,0 +1,135 @@
+package bimg
+
+import (
+	"testing"
+)
+
+func TestFindTrim(t *testing.T) {
+	if !(VipsMajorVersion >= 8 && VipsMinorVersion >= 6) {
+		t.Skipf("Skipping this test, libvips doesn't meet version requirement %s >= 8.6", VipsVersion)
+	}
+
+	buf, _ := Read("testdata/test.png")
+
+	rect, err := FindTrim(buf, Color{0, 0, 0}, 10)
+	if err != nil {
+		t.Fatalf("Cannot find trim area: %s", err)
+	}
+
+	if rect.Width != 400 || rect.Height != 257 {
+		t.Errorf("Invalid trim area: %#v", rect)
+	}
+
+	_, result, err := ResizeWithResult(buf, Options{Trim: true, Background: Color{0, 0, 0}, Threshold: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Trim == nil || *result.Trim != rect {
+		t.Errorf("Expected trim result %#v, got %#v", rect, result.Trim)
+	}
+}
+
+func TestFindTrimOffCentre(t *testing.T) {
+	if !(VipsMajorVersion >= 8 && VipsMinorVersion >= 6) {
+		t.Skipf("Skipping this test, libvips doesn't meet version requirement %s >= 8.6", VipsVersion)
+	}
+
+	subject, err := NewCanvas(40, 25, ColorRGBA{255, 255, 255, 255}, PNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		background ColorRGBA
+		find       func([]byte) (Rect, error)
+		options    Options
+	}{
+		{"background", ColorRGBA{0, 0, 0, 255}, func(buf []byte) (Rect, error) {
+			return FindTrim(buf, Color{0, 0, 0}, 10)
+		}, Options{Trim: true, Background: Color{0, 0, 0}, Threshold: 10}},
+		{"alpha", ColorRGBA{}, func(buf []byte) (Rect, error) {
+			return FindTrimAlpha(buf, 0)
+		}, Options{Trim: true, TrimAlpha: true}},
+	}
+
+	expected := Rect{Left: 30, Top: 10, Width: 40, Height: 25}
+	for _, test := range tests {
+		buf, err := Resize(subject, Options{
+			Padding:          Padding{Top: 10, Right: 5, Bottom: 20, Left: 30},
+			CanvasBackground: &test.background,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rect, err := test.find(buf)
+		if err != nil {
+			t.Fatalf("Cannot find %s trim area: %s", test.name, err)
+		}
+		if rect != expected {
+			t.Errorf("Invalid %s trim area: %#v", test.name, rect)
+		}
+
+		newImg, result, err := ResizeWithResult(buf, test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Trim == nil || *result.Trim != expected {
+			t.Errorf("Invalid %s trim result: %#v", test.name, result.Trim)
+		}
+		if err := assertSize(newImg, 40, 25); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestFindTrimAlpha(t *testing.T) {
+	if !(VipsMajorVersion >= 8 && VipsMinorVersion >= 6) {
+		t.Skipf("Skipping this test, libvips doesn't meet version requirement %s >= 8.6", VipsVersion)
+	}
+
+	buf, _ := Read("testdata/transparent.png")
+
+	rect, err := FindTrimAlpha(buf, 0)
+	if err != nil {
+		t.Fatalf("Cannot find trim area: %s", err)
+	}
+
+	if rect.Width <= 0 || rect.Height <= 0 || rect.Left+rect.Width > 320 || rect.Top+rect.Height > 240 {
+		t.Fatalf("Invalid trim area: %#v", rect)
+	}
+	if rect.Width == 320 && rect.Height == 240 {
+		t.Fatal("Expected transparent borders to be trimmed")
+	}
+
+	newImg, err := Resize(buf, Options{Trim: true, TrimAlpha: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := assertSize(newImg, rect.Width, rect.Height); err != nil {
+		t.Error(err)
+	}
+
+	meta, _ := Metadata(newImg)
+	if !meta.Alpha {
+		t.Fatal("Expected alpha channel to be preserved")
+	}
+}
+
+func TestFindTrimAlphaOpaqueImage(t *testing.T) {
+	if !(VipsMajorVersion >= 8 && VipsMinorVersion >= 6) {
+		t.Skipf("Skipping this test, libvips doesn't meet version requirement %s >= 8.6", VipsVersion)
+	}
+
+	buf, _ := Read("testdata/test.jpg")
+
+	rect, err := FindTrimAlpha(buf, 0)
+	if err != nil {
+		t.Fatalf("Cannot find trim area: %s", err)
+	}
+
+	if rect != (Rect{Width: 1680, Height: 1050}) {
+		t.Errorf("Expected the whole image, got %#v", rect)
+	}
+}
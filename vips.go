@@ -72,11 +72,24 @@ type vipsWatermarkImageOptions struct {
 	Left    C.int
 	Top     C.int
 	Opacity C.float
+	Tile    C.int
 }
 
-type vipsWatermarkTextOptions struct {
-	Text *C.char
-	Font *C.char
+type vipsTextLayerOptions struct {
+	Text     *C.char
+	Font     *C.char
+	FontFile *C.char
+	Width    C.int
+	Height   C.int
+	DPI      C.int
+	Align    C.int
+	Justify  C.int
+	Rgba     C.int
+	Padding  C.int
+	HasBox   C.int
+	Color    [4]C.double
+	Box      [4]C.double
+	Angle    C.double
 }
 
 func init() {
@@ -120,6 +133,7 @@ func Initialize() {
 
 // Shutdown is used to shutdown libvips in a thread-safe way.
 // You can call this to drop caches as well.
+// It also removes the temporary files of in-memory fonts.
 // If libvips was already initialized, the function is no-op
 func Shutdown() {
 	m.Lock()
@@ -129,6 +143,8 @@ func Shutdown() {
 		C.vips_shutdown()
 		initialized = false
 	}
+
+	removeFontFiles()
 }
 
 // VipsCacheSetMaxMem Sets the maximum amount of tracked memory allowed before the vips operation cache
@@ -292,6 +308,24 @@ func vipsRotate(image *C.VipsImage, angle Angle) (*C.VipsImage, error) {
 	return out, nil
 }
 
+func vipsRotateDegrees(image *C.VipsImage, degrees float64, i Interpolator, background ColorRGBA) (*C.VipsImage, error) {
+	var out *C.VipsImage
+	cstring := C.CString(i.String())
+	interpolator := C.vips_interpolate_new(cstring)
+
+	defer C.free(unsafe.Pointer(cstring))
+	defer C.g_object_unref(C.gpointer(image))
+	defer C.g_object_unref(C.gpointer(interpolator))
+
+	err := C.vips_similarity_bridge(image, &out, C.double(degrees), interpolator,
+		C.double(background.R), C.double(background.G), C.double(background.B), C.double(background.A))
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+
+	return out, nil
+}
+
 func vipsAutoRotate(image *C.VipsImage) (*C.VipsImage, error) {
 	var out *C.VipsImage
 	defer C.g_object_unref(C.gpointer(image))
@@ -354,24 +388,118 @@ func vipsWatermark(image *C.VipsImage, w Watermark) (*C.VipsImage, error) {
 		noReplicate = 1
 	}
 
-	text := C.CString(w.Text)
-	font := C.CString(w.Font)
-	background := [3]C.double{C.double(w.Background.R), C.double(w.Background.G), C.double(w.Background.B)}
+	textOpts, free, err := vipsTextOptions(watermarkTextOptions(w))
+	if err != nil {
+		return nil, err
+	}
+	defer free()
 
-	textOpts := vipsWatermarkTextOptions{text, font}
+	background := [3]C.double{C.double(w.Background.R), C.double(w.Background.G), C.double(w.Background.B)}
 	opts := vipsWatermarkOptions{C.int(w.Width), C.int(w.DPI), C.int(w.Margin), C.int(noReplicate), C.float(w.Opacity), background}
 
-	defer C.free(unsafe.Pointer(text))
-	defer C.free(unsafe.Pointer(font))
+	e := C.vips_watermark(image, &out, (*C.TextLayerOptions)(unsafe.Pointer(&textOpts)), (*C.WatermarkOptions)(unsafe.Pointer(&opts)))
+	if e != 0 {
+		return nil, catchVipsError()
+	}
 
-	err := C.vips_watermark(image, &out, (*C.WatermarkTextOptions)(unsafe.Pointer(&textOpts)), (*C.WatermarkOptions)(unsafe.Pointer(&opts)))
-	if err != 0 {
+	return out, nil
+}
+
+var textAligns = map[TextAlign]C.int{
+	TextAlignLeft:   C.VIPS_ALIGN_LOW,
+	TextAlignCentre: C.VIPS_ALIGN_CENTRE,
+	TextAlignRight:  C.VIPS_ALIGN_HIGH,
+}
+
+// vipsTextOptions converts the text options to their C representation.
+// The returned function frees the C strings.
+func vipsTextOptions(o TextOptions) (vipsTextLayerOptions, func(), error) {
+	align, ok := textAligns[o.Align]
+	if !ok {
+		return vipsTextLayerOptions{}, nil, errors.New("Invalid text alignment")
+	}
+
+	fontFile, err := textFontFile(o)
+	if err != nil {
+		return vipsTextLayerOptions{}, nil, err
+	}
+
+	opts := vipsTextLayerOptions{
+		Text:     C.CString(o.Text),
+		Font:     C.CString(o.Font),
+		FontFile: C.CString(fontFile),
+		Width:    C.int(o.Width),
+		Height:   C.int(o.Height),
+		DPI:      C.int(o.DPI),
+		Align:    align,
+	}
+	if o.Justify {
+		opts.Justify = 1
+	}
+
+	free := func() {
+		C.free(unsafe.Pointer(opts.Text))
+		C.free(unsafe.Pointer(opts.Font))
+		C.free(unsafe.Pointer(opts.FontFile))
+	}
+
+	return opts, free, nil
+}
+
+func vipsTextLayer(o TextOptions, color ColorRGBA, box *ColorRGBA, padding int, angle float64) (*C.VipsImage, error) {
+	var out *C.VipsImage
+
+	// Coloured spans need the text to be rendered in colour, with
+	// the layer colour as default
+	rgba := o.Markup && (VipsMajorVersion > 8 || (VipsMajorVersion == 8 && VipsMinorVersion >= 12))
+	o.Text = textMarkup(o)
+	if rgba {
+		o.Text = colorSpan(o.Text, color)
+	}
+
+	opts, free, err := vipsTextOptions(o)
+	if err != nil {
+		return nil, err
+	}
+	defer free()
+
+	opts.Padding = C.int(padding)
+	opts.Angle = C.double(angle)
+	opts.Color = [4]C.double{C.double(color.R), C.double(color.G), C.double(color.B), C.double(color.A)}
+	if rgba {
+		opts.Rgba = 1
+	}
+	if box != nil {
+		opts.HasBox = 1
+		opts.Box = [4]C.double{C.double(box.R), C.double(box.G), C.double(box.B), C.double(box.A)}
+	}
+
+	e := C.vips_text_layer_bridge(&out, (*C.TextLayerOptions)(unsafe.Pointer(&opts)))
+	if e != 0 {
 		return nil, catchVipsError()
 	}
 
 	return out, nil
 }
 
+func vipsMeasureText(o TextOptions) (int, int, error) {
+	var width, height C.int
+
+	o.Text = textMarkup(o)
+	opts, free, err := vipsTextOptions(o)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer free()
+
+	e := C.vips_text_measure_bridge((*C.TextLayerOptions)(unsafe.Pointer(&opts)), &width, &height)
+	if e != 0 {
+		return 0, 0, catchVipsError()
+	}
+
+	return int(width), int(height), nil
+}
+
 func vipsRead(buf []byte) (*C.VipsImage, ImageType, error) {
 	var image *C.VipsImage
 	imageType := vipsImageType(buf)
@@ -391,6 +519,56 @@ func vipsRead(buf []byte) (*C.VipsImage, ImageType, error) {
 	return image, imageType, nil
 }
 
+func vipsReadRaw(r RawImage) (*C.VipsImage, error) {
+	var image *C.VipsImage
+
+	if len(r.Pixels) == 0 {
+		return nil, errors.New("Raw pixel buffer is empty")
+	}
+	if len(r.Pixels) != r.Width*r.Height*r.Bands*r.Format.Size() {
+		return nil, errors.New("Raw pixel buffer size does not match the image dimensions")
+	}
+
+	length := C.size_t(len(r.Pixels))
+	pixels := unsafe.Pointer(&r.Pixels[0])
+
+	err := C.vips_image_new_from_memory_bridge(pixels, length, C.int(r.Width), C.int(r.Height), C.int(r.Bands), C.int(r.Format), &image)
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+
+	return image, nil
+}
+
+func vipsExportRaw(image *C.VipsImage, o vipsSaveOptions) (RawImage, error) {
+	defer C.g_object_unref(C.gpointer(image))
+
+	tmpImage, err := vipsPreSave(image, &o)
+	if err != nil {
+		return RawImage{}, err
+	}
+
+	// See vipsSave: vipsPreSave may return the very same image
+	if tmpImage != image {
+		defer C.g_object_unref(C.gpointer(tmpImage))
+	}
+
+	length := C.size_t(0)
+	ptr := C.vips_image_write_to_memory(tmpImage, &length)
+	if ptr == nil {
+		return RawImage{}, catchVipsError()
+	}
+	defer C.g_free(C.gpointer(ptr))
+
+	return RawImage{
+		Width:  int(tmpImage.Xsize),
+		Height: int(tmpImage.Ysize),
+		Bands:  int(tmpImage.Bands),
+		Format: BandFormat(tmpImage.BandFmt),
+		Pixels: C.GoBytes(ptr, C.int(length)),
+	}, nil
+}
+
 func vipsColourspaceIsSupportedBuffer(buf []byte) (bool, error) {
 	image, _, err := vipsRead(buf)
 	if err != nil {
@@ -554,6 +732,57 @@ func vipsSave(image *C.VipsImage, o vipsSaveOptions) ([]byte, error) {
 	return buf, nil
 }
 
+var dzLayouts = map[DZLayout]C.int{
+	DZLayoutDZ:      C.VIPS_FOREIGN_DZ_LAYOUT_DZ,
+	DZLayoutZoomify: C.VIPS_FOREIGN_DZ_LAYOUT_ZOOMIFY,
+	DZLayoutGoogle:  C.VIPS_FOREIGN_DZ_LAYOUT_GOOGLE,
+	DZLayoutIIIF:    C.VIPS_FOREIGN_DZ_LAYOUT_IIIF,
+	DZLayoutIIIF3:   C.VIPS_FOREIGN_DZ_LAYOUT_IIIF3,
+}
+
+func vipsDeepZoom(image *C.VipsImage, o DZOptions) ([]byte, error) {
+	defer C.g_object_unref(C.gpointer(image))
+
+	suffix := dzSuffixes[o.Type]
+	if o.Type != PNG {
+		suffix = fmt.Sprintf("%s[Q=%d]", suffix, o.Quality)
+	}
+	csuffix := C.CString(suffix)
+	defer C.free(unsafe.Pointer(csuffix))
+
+	layout := dzLayouts[o.Layout]
+	tileSize := C.int(o.TileSize)
+	overlap := C.int(o.Overlap)
+	depth := C.int(o.Depth)
+
+	if o.Path != "" {
+		path := C.CString(o.Path)
+		defer C.free(unsafe.Pointer(path))
+
+		err := C.vips_dzsave_bridge(image, path, layout, tileSize, overlap, depth, csuffix)
+		if int(err) != 0 {
+			return nil, catchVipsError()
+		}
+		return nil, nil
+	}
+
+	var ptr unsafe.Pointer
+	length := C.size_t(0)
+
+	err := C.vips_dzsave_buffer_bridge(image, &ptr, &length, layout, tileSize, overlap, depth, csuffix)
+	if int(err) != 0 {
+		return nil, catchVipsError()
+	}
+
+	buf := C.GoBytes(ptr, C.int(length))
+
+	// Clean up
+	C.g_free(C.gpointer(ptr))
+	C.vips_error_clear()
+
+	return buf, nil
+}
+
 func getImageBuffer(image *C.VipsImage) ([]byte, error) {
 	var ptr unsafe.Pointer
 
@@ -590,39 +819,80 @@ func vipsExtract(image *C.VipsImage, left, top, width, height int) (*C.VipsImage
 	return buf, nil
 }
 
-func vipsSmartCrop(image *C.VipsImage, width, height int) (*C.VipsImage, error) {
+var smartCropStrategies = map[SmartCropStrategy]C.int{
+	SmartCropAttention: C.VIPS_INTERESTING_ATTENTION,
+	SmartCropEntropy:   C.VIPS_INTERESTING_ENTROPY,
+	SmartCropCentre:    C.VIPS_INTERESTING_CENTRE,
+	SmartCropLow:       C.VIPS_INTERESTING_LOW,
+	SmartCropHigh:      C.VIPS_INTERESTING_HIGH,
+}
+
+// vipsSmartCrop returns the cropped image and the kept area, along with the
+// attention point when the strategy reports it.
+func vipsSmartCrop(image *C.VipsImage, width, height int, strategy SmartCropStrategy) (*C.VipsImage, SmartCropResult, error) {
 	var buf *C.VipsImage
+	var area C.SmartCropArea
 	defer C.g_object_unref(C.gpointer(image))
 
 	if width > maxSize || height > maxSize {
-		return nil, errors.New("Maximum image size exceeded")
+		return nil, SmartCropResult{}, errors.New("Maximum image size exceeded")
+	}
+
+	interesting, ok := smartCropStrategies[strategy]
+	if !ok {
+		return nil, SmartCropResult{}, errors.New("Invalid smart crop strategy")
+	}
+	if (strategy == SmartCropLow || strategy == SmartCropHigh) &&
+		!(VipsMajorVersion > 8 || (VipsMajorVersion == 8 && VipsMinorVersion >= 6)) {
+		return nil, SmartCropResult{}, errors.New("Low and high smart crop strategies require libvips 8.6+")
 	}
 
-	err := C.vips_smartcrop_bridge(image, &buf, C.int(width), C.int(height))
+	err := C.vips_smartcrop_bridge(image, &buf, C.int(width), C.int(height), interesting, &area)
 	if err != 0 {
-		return nil, catchVipsError()
+		return nil, SmartCropResult{}, catchVipsError()
 	}
 
-	return buf, nil
+	return buf, SmartCropResult{
+		Box:          Rect{Left: int(area.Left), Top: int(area.Top), Width: int(area.Width), Height: int(area.Height)},
+		HasAttention: area.HasAttention != 0,
+		AttentionX:   int(area.AttentionX),
+		AttentionY:   int(area.AttentionY),
+	}, nil
 }
 
 func vipsTrim(image *C.VipsImage, background Color, threshold float64) (int, int, int, int, error) {
 	defer C.g_object_unref(C.gpointer(image))
 
-	top := C.int(0)
 	left := C.int(0)
+	top := C.int(0)
 	width := C.int(0)
 	height := C.int(0)
 
 	err := C.vips_find_trim_bridge(image,
-		&top, &left, &width, &height,
+		&left, &top, &width, &height,
 		C.double(background.R), C.double(background.G), C.double(background.B),
 		C.double(threshold))
 	if err != 0 {
 		return 0, 0, 0, 0, catchVipsError()
 	}
 
-	return int(top), int(left), int(width), int(height), nil
+	return int(left), int(top), int(width), int(height), nil
+}
+
+func vipsTrimAlpha(image *C.VipsImage, threshold float64) (int, int, int, int, error) {
+	defer C.g_object_unref(C.gpointer(image))
+
+	left := C.int(0)
+	top := C.int(0)
+	width := C.int(0)
+	height := C.int(0)
+
+	err := C.vips_find_trim_alpha_bridge(image, &left, &top, &width, &height, C.double(threshold))
+	if err != 0 {
+		return 0, 0, 0, 0, catchVipsError()
+	}
+
+	return int(left), int(top), int(width), int(height), nil
 }
 
 func vipsShrinkJpeg(buf []byte, input *C.VipsImage, shrink int) (*C.VipsImage, error) {
@@ -693,6 +963,19 @@ func vipsEmbed(input *C.VipsImage, left, top, width, height int, extend Extend,
 	return image, nil
 }
 
+func vipsEmbedRGBA(input *C.VipsImage, left, top, width, height int, background ColorRGBA) (*C.VipsImage, error) {
+	var image *C.VipsImage
+
+	defer C.g_object_unref(C.gpointer(input))
+	err := C.vips_embed_rgba_bridge(input, &image, C.int(left), C.int(top), C.int(width), C.int(height),
+		C.double(background.R), C.double(background.G), C.double(background.B), C.double(background.A))
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+
+	return image, nil
+}
+
 func vipsAffine(input *C.VipsImage, residualx, residualy float64, i Interpolator, extend Extend) (*C.VipsImage, error) {
 	if extend > 5 {
 		extend = ExtendBackground
@@ -714,6 +997,53 @@ func vipsAffine(input *C.VipsImage, residualx, residualy float64, i Interpolator
 	return image, nil
 }
 
+func vipsAffineTransform(input *C.VipsImage, matrix [4]float64, translate [2]float64, area Rect, i Interpolator, extend Extend) (*C.VipsImage, error) {
+	if extend > 5 {
+		extend = ExtendBackground
+	}
+
+	var image *C.VipsImage
+	cstring := C.CString(i.String())
+	interpolator := C.vips_interpolate_new(cstring)
+
+	defer C.free(unsafe.Pointer(cstring))
+	defer C.g_object_unref(C.gpointer(input))
+	defer C.g_object_unref(C.gpointer(interpolator))
+
+	err := C.vips_affine_transform_bridge(input, &image,
+		C.double(matrix[0]), C.double(matrix[1]), C.double(matrix[2]), C.double(matrix[3]),
+		C.double(translate[0]), C.double(translate[1]),
+		C.int(area.Left), C.int(area.Top), C.int(area.Width), C.int(area.Height),
+		interpolator, C.int(extend))
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+
+	return image, nil
+}
+
+func vipsPerspective(input *C.VipsImage, width, height int, matrix [9]float64, i Interpolator) (*C.VipsImage, error) {
+	var image *C.VipsImage
+	cstring := C.CString(i.String())
+	interpolator := C.vips_interpolate_new(cstring)
+
+	defer C.free(unsafe.Pointer(cstring))
+	defer C.g_object_unref(C.gpointer(input))
+	defer C.g_object_unref(C.gpointer(interpolator))
+
+	if width > maxSize || height > maxSize {
+		return nil, errors.New("Maximum image size exceeded")
+	}
+
+	err := C.vips_perspective_bridge(input, &image, C.int(width), C.int(height),
+		(*C.double)(unsafe.Pointer(&matrix[0])), interpolator)
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+
+	return image, nil
+}
+
 func vipsImageType(buf []byte) ImageType {
 	if len(buf) < 12 {
 		return UNKNOWN
@@ -844,7 +1174,28 @@ func vipsDrawWatermark(image *C.VipsImage, o WatermarkImage) (*C.VipsImage, erro
 		return nil, e
 	}
 
-	opts := vipsWatermarkImageOptions{C.int(o.Left), C.int(o.Top), C.float(o.Opacity)}
+	if o.Scale > 0 || o.Angle != 0 {
+		scale := o.Scale * float64(image.Xsize) / float64(watermark.Xsize)
+		watermark, e = vipsWatermarkTransform(watermark, scale, o.Angle)
+		if e != nil {
+			return nil, e
+		}
+	}
+
+	left, top := o.Left, o.Top
+	if o.Tile {
+		if o.Spacing > 0 {
+			width, height := int(watermark.Xsize)+o.Spacing, int(watermark.Ysize)+o.Spacing
+			watermark, e = vipsEmbedRGBA(watermark, 0, 0, width, height, ColorRGBA{})
+			if e != nil {
+				return nil, e
+			}
+		}
+	} else if o.Gravity != nil {
+		left, top = calculateWatermarkPosition(int(watermark.Xsize), int(watermark.Ysize), int(image.Xsize), int(image.Ysize), *o.Gravity, o.Margin, o.Left, o.Top)
+	}
+
+	opts := vipsWatermarkImageOptions{C.int(left), C.int(top), C.float(o.Opacity), C.int(boolToInt(o.Tile))}
 
 	err := C.vips_watermark_image(image, watermark, &out, (*C.WatermarkImageOptions)(unsafe.Pointer(&opts)))
 
@@ -855,6 +1206,169 @@ func vipsDrawWatermark(image *C.VipsImage, o WatermarkImage) (*C.VipsImage, erro
 	return out, nil
 }
 
+func vipsWatermarkTransform(input *C.VipsImage, scale, angle float64) (*C.VipsImage, error) {
+	var out *C.VipsImage
+	defer C.g_object_unref(C.gpointer(input))
+
+	err := C.vips_watermark_image_transform(input, &out, C.double(scale), C.double(angle))
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+
+	return out, nil
+}
+
+func vipsCanvas(width, height int, color ColorRGBA) (*C.VipsImage, error) {
+	var out *C.VipsImage
+
+	colour, bands := vipsColorBands(color, color)
+	err := C.vips_canvas_bridge(&out, C.int(width), C.int(height), &colour[0][0], C.int(bands))
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+
+	return out, nil
+}
+
+func vipsGradient(width, height int, radial bool, p0, p1, p2 float64, start, end ColorRGBA) (*C.VipsImage, error) {
+	var out *C.VipsImage
+
+	colours, bands := vipsColorBands(start, end)
+	err := C.vips_gradient_bridge(&out, C.int(width), C.int(height), C.int(boolToInt(radial)),
+		C.double(p0), C.double(p1), C.double(p2), &colours[0][0], &colours[1][0], C.int(bands))
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+
+	return out, nil
+}
+
+// vipsColorBands returns the given colours as C arrays, along with the
+// number of bands needed, leaving the alpha band out when both are opaque.
+func vipsColorBands(a, b ColorRGBA) ([2][4]C.double, int) {
+	colours := [2][4]C.double{
+		{C.double(a.R), C.double(a.G), C.double(a.B), C.double(a.A)},
+		{C.double(b.R), C.double(b.G), C.double(b.B), C.double(b.A)},
+	}
+	if a.A == 255 && b.A == 255 {
+		return colours, 3
+	}
+	return colours, 4
+}
+
+var aligns = map[Align]C.int{
+	AlignLow:    C.VIPS_ALIGN_LOW,
+	AlignCentre: C.VIPS_ALIGN_CENTRE,
+	AlignHigh:   C.VIPS_ALIGN_HIGH,
+}
+
+// vipsArrayJoin joins the given images into a grid, taking ownership of them.
+func vipsArrayJoin(images []*C.VipsImage, across, spacing, cellWidth, cellHeight int, halign, valign Align, background ColorRGBA, alpha bool) (*C.VipsImage, error) {
+	var out *C.VipsImage
+
+	h, ok := aligns[halign]
+	v, ok2 := aligns[valign]
+	if !ok || !ok2 {
+		for _, image := range images {
+			C.g_object_unref(C.gpointer(image))
+		}
+		return nil, errors.New("Invalid alignment")
+	}
+
+	colour := [4]C.double{C.double(background.R), C.double(background.G), C.double(background.B), C.double(background.A)}
+	err := C.vips_arrayjoin_bridge((**C.VipsImage)(unsafe.Pointer(&images[0])), C.int(len(images)), &out,
+		C.int(across), C.int(spacing), C.int(cellWidth), C.int(cellHeight), h, v, &colour[0], C.int(boolToInt(alpha)))
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+
+	return out, nil
+}
+
+// vipsSprite inserts the given images into the sheet at their position,
+// taking ownership of the sheet and the images.
+func vipsSprite(sheet *C.VipsImage, images []*C.VipsImage, left, top []int, background ColorRGBA) (*C.VipsImage, error) {
+	var out *C.VipsImage
+
+	x := make([]C.int, len(images))
+	y := make([]C.int, len(images))
+	for i := range images {
+		x[i], y[i] = C.int(left[i]), C.int(top[i])
+	}
+
+	colour := [3]C.double{C.double(background.R), C.double(background.G), C.double(background.B)}
+	err := C.vips_sprite_bridge(sheet, (**C.VipsImage)(unsafe.Pointer(&images[0])), C.int(len(images)), &out,
+		&x[0], &y[0], &colour[0])
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+
+	return out, nil
+}
+
+var blendModes = map[BlendMode]C.int{
+	BlendOver:        C.VIPS_BLEND_MODE_OVER,
+	BlendMultiply:    C.VIPS_BLEND_MODE_MULTIPLY,
+	BlendScreen:      C.VIPS_BLEND_MODE_SCREEN,
+	BlendOverlay:     C.VIPS_BLEND_MODE_OVERLAY,
+	BlendDarken:      C.VIPS_BLEND_MODE_DARKEN,
+	BlendLighten:     C.VIPS_BLEND_MODE_LIGHTEN,
+	BlendColourDodge: C.VIPS_BLEND_MODE_COLOUR_DODGE,
+	BlendColourBurn:  C.VIPS_BLEND_MODE_COLOUR_BURN,
+	BlendHardLight:   C.VIPS_BLEND_MODE_HARD_LIGHT,
+	BlendSoftLight:   C.VIPS_BLEND_MODE_SOFT_LIGHT,
+	BlendDifference:  C.VIPS_BLEND_MODE_DIFFERENCE,
+	BlendExclusion:   C.VIPS_BLEND_MODE_EXCLUSION,
+	BlendAdd:         C.VIPS_BLEND_MODE_ADD,
+	BlendIn:          C.VIPS_BLEND_MODE_IN,
+	BlendAtop:        C.VIPS_BLEND_MODE_ATOP,
+	BlendDestOver:    C.VIPS_BLEND_MODE_DEST_OVER,
+	BlendXor:         C.VIPS_BLEND_MODE_XOR,
+}
+
+func vipsComposite(image *C.VipsImage, layer *C.VipsImage, left, top int, tile bool, opacity float32, blend BlendMode) (*C.VipsImage, error) {
+	var out *C.VipsImage
+	defer C.g_object_unref(C.gpointer(image))
+	defer C.g_object_unref(C.gpointer(layer))
+
+	mode, ok := blendModes[blend]
+	if !ok {
+		return nil, errors.New("Invalid blend mode")
+	}
+
+	err := C.vips_composite_layer_bridge(image, layer, &out, C.int(left), C.int(top),
+		C.int(boolToInt(tile)), C.double(opacity), mode)
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+
+	return out, nil
+}
+
+func vipsRoundedMask(width, height int, radius float64) (*C.VipsImage, error) {
+	var out *C.VipsImage
+
+	err := C.vips_rounded_mask_bridge(&out, C.int(width), C.int(height), C.double(radius))
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+
+	return out, nil
+}
+
+func vipsMask(image *C.VipsImage, mask *C.VipsImage) (*C.VipsImage, error) {
+	var out *C.VipsImage
+	defer C.g_object_unref(C.gpointer(image))
+	defer C.g_object_unref(C.gpointer(mask))
+
+	err := C.vips_mask_bridge(image, mask, &out)
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+
+	return out, nil
+}
+
 func vipsGamma(image *C.VipsImage, Gamma float64) (*C.VipsImage, error) {
 	var out *C.VipsImage
 	defer C.g_object_unref(C.gpointer(image))
@@ -877,6 +1391,89 @@ func vipsBrightness(image *C.VipsImage, brightness float64) (*C.VipsImage, error
 	return out, nil
 }
 
+func vipsGreyscale(image *C.VipsImage) (*C.VipsImage, error) {
+	var out *C.VipsImage
+	defer C.g_object_unref(C.gpointer(image))
+
+	err := C.vips_greyscale_bridge(image, &out)
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+	return out, nil
+}
+
+func vipsDuotone(image *C.VipsImage, shadow, highlight [3]float64) (*C.VipsImage, error) {
+	var out *C.VipsImage
+	defer C.g_object_unref(C.gpointer(image))
+
+	s := [3]C.double{C.double(shadow[0]), C.double(shadow[1]), C.double(shadow[2])}
+	h := [3]C.double{C.double(highlight[0]), C.double(highlight[1]), C.double(highlight[2])}
+	err := C.vips_duotone_bridge(image, &out, &s[0], &h[0])
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+	return out, nil
+}
+
+func vipsRecomb(image *C.VipsImage, matrix [][]float64) (*C.VipsImage, error) {
+	var out *C.VipsImage
+	defer C.g_object_unref(C.gpointer(image))
+
+	size := len(matrix)
+	if size != 3 && size != 4 {
+		return nil, errors.New("Recomb matrix must be 3x3 or 4x4")
+	}
+	values := make([]C.double, 0, size*size)
+	for _, row := range matrix {
+		if len(row) != size {
+			return nil, errors.New("Recomb matrix must be 3x3 or 4x4")
+		}
+		for _, v := range row {
+			values = append(values, C.double(v))
+		}
+	}
+
+	err := C.vips_recomb_bridge(image, &out, &values[0], C.int(size))
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+	return out, nil
+}
+
+func vipsNormalise(image *C.VipsImage, lower, upper float64) (*C.VipsImage, error) {
+	return vipsHistogram(image, C.HISTOGRAM_NORMALISE, lower, upper, 0)
+}
+
+func vipsEqualize(image *C.VipsImage) (*C.VipsImage, error) {
+	return vipsHistogram(image, C.HISTOGRAM_EQUALIZE, 0, 0, 0)
+}
+
+func vipsCLAHE(image *C.VipsImage, c CLAHE) (*C.VipsImage, error) {
+	return vipsHistogram(image, C.HISTOGRAM_CLAHE, float64(c.Width), float64(c.Height), float64(c.MaxSlope))
+}
+
+func vipsHistogram(image *C.VipsImage, operation C.int, p0, p1, p2 float64) (*C.VipsImage, error) {
+	var out *C.VipsImage
+	defer C.g_object_unref(C.gpointer(image))
+
+	err := C.vips_histogram_bridge(image, &out, operation, C.double(p0), C.double(p1), C.double(p2))
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+	return out, nil
+}
+
+func vipsModulate(image *C.VipsImage, m Modulate) (*C.VipsImage, error) {
+	var out *C.VipsImage
+	defer C.g_object_unref(C.gpointer(image))
+
+	err := C.vips_modulate_bridge(image, &out, C.double(m.Brightness), C.double(m.Saturation), C.double(m.Hue), C.double(m.Lightness))
+	if err != 0 {
+		return nil, catchVipsError()
+	}
+	return out, nil
+}
+
 func vipsContrast(image *C.VipsImage, contrast float64) (*C.VipsImage, error) {
 	var out *C.VipsImage
 	defer C.g_object_unref(C.gpointer(image))
@@ -18,6 +18,32 @@
 #define VIPS_ANGLE_D270 VIPS_ANGLE_270
 #endif
 
+/**
+ * The IIIF v3 tile layout was introduced in libvips 8.13. Define the enum value
+ * for older versions so bimg still builds; DeepZoom rejects it at runtime.
+ */
+
+#if (VIPS_MAJOR_VERSION < 8 || (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION < 13))
+#define VIPS_FOREIGN_DZ_LAYOUT_IIIF3 (VIPS_FOREIGN_DZ_LAYOUT_IIIF + 1)
+#endif
+
+/**
+ * Smart crop was introduced in libvips 8.5, and its low and high strategies
+ * in libvips 8.6. Define the enum values for older versions so bimg still
+ * builds; smart crop rejects them at runtime.
+ */
+
+#if (VIPS_MAJOR_VERSION < 8 || (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION < 5))
+#define VIPS_INTERESTING_CENTRE 1
+#define VIPS_INTERESTING_ENTROPY 2
+#define VIPS_INTERESTING_ATTENTION 3
+#endif
+
+#if (VIPS_MAJOR_VERSION < 8 || (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION < 6))
+#define VIPS_INTERESTING_LOW (VIPS_INTERESTING_ATTENTION + 1)
+#define VIPS_INTERESTING_HIGH (VIPS_INTERESTING_ATTENTION + 2)
+#endif
+
 #define EXIF_IFD0_ORIENTATION "exif-ifd0-Orientation"
 
 #define INT_TO_GBOOLEAN(bool) (bool > 0 ? TRUE : FALSE)
@@ -38,10 +64,11 @@ enum types {
 	JXL
 };
 
-typedef struct {
-	const char *Text;
-	const char *Font;
-} WatermarkTextOptions;
+enum histograms {
+	HISTOGRAM_NORMALISE,
+	HISTOGRAM_EQUALIZE,
+	HISTOGRAM_CLAHE
+};
 
 typedef struct {
 	int    Width;
@@ -56,8 +83,106 @@ typedef struct {
 	int    Left;
 	int    Top;
 	float    Opacity;
+	int    Tile;
 } WatermarkImageOptions;
 
+typedef struct {
+	int    Left;
+	int    Top;
+	int    Width;
+	int    Height;
+	int    HasAttention;
+	int    AttentionX;
+	int    AttentionY;
+} SmartCropArea;
+
+typedef struct {
+	const char *Text;
+	const char *Font;
+	const char *FontFile;
+	int    Width;
+	int    Height;
+	int    DPI;
+	int    Align;
+	int    Justify;
+	int    Rgba;
+	int    Padding;
+	int    HasBox;
+	double Color[4];
+	double Box[4];
+	double Angle;
+} TextLayerOptions;
+
+static int
+vips_text_render(VipsImage **out, TextLayerOptions *o) {
+	const char *fontfile = o->FontFile != NULL && o->FontFile[0] != '\0' ? o->FontFile : NULL;
+
+	// libvips only fits the text to the box when no dpi is given, and
+	// uses its own default dpi when it is zero
+#if (VIPS_MAJOR_VERSION > 8 || (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION >= 12))
+	if (o->Height > 0 || o->DPI <= 0) {
+		return vips_text(out, o->Text,
+			"font", o->Font,
+			"fontfile", fontfile,
+			"width", o->Width,
+			"height", o->Height,
+			"align", o->Align,
+			"justify", o->Justify,
+			"rgba", o->Rgba,
+			NULL);
+	}
+	return vips_text(out, o->Text,
+		"font", o->Font,
+		"fontfile", fontfile,
+		"width", o->Width,
+		"dpi", o->DPI,
+		"align", o->Align,
+		"justify", o->Justify,
+		"rgba", o->Rgba,
+		NULL);
+#elif (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION >= 9)
+	if (o->Height > 0 || o->Rgba) {
+		vips_error("vips_text_render", "text autofit and colours require libvips 8.12+");
+		return 1;
+	}
+	if (o->DPI <= 0) {
+		return vips_text(out, o->Text,
+			"font", o->Font,
+			"fontfile", fontfile,
+			"width", o->Width,
+			"align", o->Align,
+			"justify", o->Justify,
+			NULL);
+	}
+	return vips_text(out, o->Text,
+		"font", o->Font,
+		"fontfile", fontfile,
+		"width", o->Width,
+		"dpi", o->DPI,
+		"align", o->Align,
+		"justify", o->Justify,
+		NULL);
+#else
+	if (fontfile != NULL || o->Height > 0 || o->Rgba || o->Justify) {
+		vips_error("vips_text_render", "font files and text justification require libvips 8.9+");
+		return 1;
+	}
+	if (o->DPI <= 0) {
+		return vips_text(out, o->Text,
+			"font", o->Font,
+			"width", o->Width,
+			"align", o->Align,
+			NULL);
+	}
+	return vips_text(out, o->Text,
+		"font", o->Font,
+		"width", o->Width,
+		"dpi", o->DPI,
+		"align", o->Align,
+		NULL);
+#endif
+}
+
 static unsigned long
 has_profile_embed(VipsImage *image) {
 	return vips_image_get_typeof(image, VIPS_META_ICC_NAME);
@@ -542,7 +667,7 @@ vips_watermark_replicate (VipsImage *orig, VipsImage *in, VipsImage **out) {
 }
 
 int
-vips_watermark(VipsImage *in, VipsImage **out, WatermarkTextOptions *to, WatermarkOptions *o) {
+vips_watermark(VipsImage *in, VipsImage **out, TextLayerOptions *to, WatermarkOptions *o) {
 	double ones[3] = { 1, 1, 1 };
 
 	VipsImage *base = vips_image_new();
@@ -551,11 +676,7 @@ vips_watermark(VipsImage *in, VipsImage **out, WatermarkTextOptions *to, Waterma
 
 	// Make the mask.
 	if (
-		vips_text(&t[1], to->Text,
-			"width", o->Width,
-			"dpi", o->DPI,
-			"font", to->Font,
-			NULL) ||
+		vips_text_render(&t[1], to) ||
 		vips_linear1(t[1], &t[2], o->Opacity, 0.0, NULL) ||
 		vips_cast(t[2], &t[3], VIPS_FORMAT_UCHAR, NULL) ||
 		vips_embed(t[3], &t[4], 100, 100, t[3]->Xsize + o->Margin, t[3]->Ysize + o->Margin, NULL)
@@ -633,6 +754,56 @@ vips_add_band(VipsImage *in, VipsImage **out, double c) {
 #endif
 }
 
+// vips_add_alpha adds an opaque alpha band, scaled to the image format.
+static int
+vips_add_alpha(VipsImage *in, VipsImage **out) {
+	return vips_add_band(in, out, vips_is_16bit(in->Type) ? 65535.0 : 255.0);
+}
+
+// vips_split_alpha sets the alpha band of the image aside, if any, so that
+// it can be joined back untouched by vips_join_alpha. Both images are owned
+// by base.
+static int
+vips_split_alpha(VipsObject *base, VipsImage *in, VipsImage **image, VipsImage **alpha) {
+	VipsImage **t = (VipsImage **) vips_object_local_array(base, 2);
+
+	*image = in;
+	*alpha = NULL;
+	if (has_alpha_channel(in) == 0) {
+		return 0;
+	}
+
+	if (
+		vips_extract_band(in, &t[0], 0, "n", in->Bands - 1, NULL) ||
+		vips_extract_band(in, &t[1], in->Bands - 1, "n", 1, NULL)
+	) {
+		return 1;
+	}
+
+	*image = t[0];
+	*alpha = t[1];
+	return 0;
+}
+
+// vips_join_alpha converts the image, worked on in the given colour space,
+// back to interpretation and joins the alpha band set aside, if any.
+static int
+vips_join_alpha(VipsObject *base, VipsImage *in, VipsImage **out, VipsInterpretation space, VipsInterpretation interpretation, VipsImage *alpha) {
+	VipsImage **t = (VipsImage **) vips_object_local_array(base, 2);
+
+	if (
+		vips_copy(in, &t[0], "interpretation", space, NULL) ||
+		vips_colourspace(t[0], &t[1], interpretation, NULL)
+	) {
+		return 1;
+	}
+
+	if (alpha != NULL) {
+		return vips_bandjoin2(t[1], alpha, out, NULL);
+	}
+	return vips_copy(t[1], out, NULL);
+}
+
 int
 vips_watermark_image(VipsImage *in, VipsImage *sub, VipsImage **out, WatermarkImageOptions *o) {
 	VipsImage *base = vips_image_new();
@@ -655,9 +826,10 @@ vips_watermark_image(VipsImage *in, VipsImage *sub, VipsImage **out, WatermarkIm
 	}
 
 	// Place watermark image in the right place and size it to the size of the
-	// image that should be watermarked
+	// image that should be watermarked, repeating it when tiled
+	int extend = o->Tile ? VIPS_EXTEND_REPEAT : VIPS_EXTEND_BLACK;
 	if (
-		vips_embed(t[1], &t[2], o->Left, o->Top, t[0]->Xsize, t[0]->Ysize, NULL)) {
+		vips_embed(t[1], &t[2], o->Left, o->Top, t[0]->Xsize, t[0]->Ysize, "extend", extend, NULL)) {
 			g_object_unref(base);
 		return 1;
 	}
@@ -669,7 +841,7 @@ vips_watermark_image(VipsImage *in, VipsImage *sub, VipsImage **out, WatermarkIm
 		vips_linear1(t[3], &t[4], o->Opacity, 0.0, NULL) ||
 		vips_cast(t[4], &t[5], VIPS_FORMAT_UCHAR, NULL) ||
 		vips_copy(t[5], &t[6], "interpretation", t[0]->Type, NULL) ||
-		vips_embed(t[6], &t[7], o->Left, o->Top, t[0]->Xsize, t[0]->Ysize, NULL))	{
+		vips_embed(t[6], &t[7], o->Left, o->Top, t[0]->Xsize, t[0]->Ysize, "extend", extend, NULL))	{
 			g_object_unref(base);
 		return 1;
 	}
@@ -685,15 +857,117 @@ vips_watermark_image(VipsImage *in, VipsImage *sub, VipsImage **out, WatermarkIm
 }
 
 int
-vips_smartcrop_bridge(VipsImage *in, VipsImage **out, int width, int height) {
-#if (VIPS_MAJOR_VERSION >= 8 && VIPS_MINOR_VERSION >= 5)
-	return vips_smartcrop(in, out, width, height, NULL);
+vips_watermark_image_transform(VipsImage *in, VipsImage **out, double scale, double angle) {
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 3);
+	VipsImage *image = in;
+
+	if (has_alpha_channel(image) == 0) {
+		if (vips_add_alpha(image, &t[0])) {
+			g_object_unref(base);
+			return 1;
+		}
+		image = t[0];
+	}
+
+	if (scale > 0 && scale != 1) {
+		if (vips_resize(image, &t[1], scale, NULL)) {
+			g_object_unref(base);
+			return 1;
+		}
+		image = t[1];
+	}
+
+	if (angle != 0) {
+		double *transparent = VIPS_ARRAY(base, image->Bands, double);
+		VipsArrayDouble *background;
+		int i, code;
+
+		for (i = 0; i < image->Bands; i++) {
+			transparent[i] = 0;
+		}
+		background = vips_array_double_new(transparent, image->Bands);
+		code = vips_similarity(image, &t[2], "angle", angle, "background", background, NULL);
+		vips_area_unref(VIPS_AREA(background));
+		if (code) {
+			g_object_unref(base);
+			return 1;
+		}
+		image = t[2];
+	}
+
+	if (vips_copy(image, out, NULL)) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+}
+
+int
+vips_smartcrop_bridge(VipsImage *in, VipsImage **out, int width, int height, int interesting, SmartCropArea *area) {
+#if (VIPS_MAJOR_VERSION > 8 || (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION >= 5))
+	area->Width = width;
+	area->Height = height;
+	area->HasAttention = 0;
+
+#if (VIPS_MAJOR_VERSION > 8 || (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION >= 8))
+	if (vips_smartcrop(in, out, width, height,
+		"interesting", interesting,
+		"attention_x", &area->AttentionX,
+		"attention_y", &area->AttentionY,
+		NULL
+	)) {
+		return 1;
+	}
+	area->HasAttention = interesting == VIPS_INTERESTING_ATTENTION;
 #else
+	if (vips_smartcrop(in, out, width, height, "interesting", interesting, NULL)) {
+		return 1;
+	}
+#endif
+
+	// Find the area the same way vips_smartcrop does
+	switch (interesting) {
+	case VIPS_INTERESTING_CENTRE:
+		area->Left = (in->Xsize - width) / 2;
+		area->Top = (in->Ysize - height) / 2;
+		return 0;
+	case VIPS_INTERESTING_LOW:
+		area->Left = 0;
+		area->Top = 0;
+		return 0;
+	case VIPS_INTERESTING_HIGH:
+		area->Left = in->Xsize - width;
+		area->Top = in->Ysize - height;
+		return 0;
+	}
+
+	if (area->HasAttention) {
+		area->Left = VIPS_CLIP(0, area->AttentionX - width / 2, in->Xsize - width);
+		area->Top = VIPS_CLIP(0, area->AttentionY - height / 2, in->Ysize - height);
+		return 0;
+	}
+
+	// The entropy search is not reported, but the area is extracted
+	// with vips_extract_area, which records its origin in the offsets
+	area->Left = -(*out)->Xoffset;
+	area->Top = -(*out)->Yoffset;
+	if (area->Left < 0 || area->Top < 0 || area->Left + width > in->Xsize || area->Top + height > in->Ysize) {
+		g_object_unref(*out);
+		vips_error("vips_smartcrop_bridge", "cannot find the smart crop area");
+		return 1;
+	}
+
 	return 0;
+#else
+	vips_error("vips_smartcrop_bridge", "smart crop requires libvips 8.5+");
+	return 1;
 #endif
 }
 
-int vips_find_trim_bridge(VipsImage *in, int *top, int *left, int *width, int *height, double r, double g, double b, double threshold) {
+int vips_find_trim_bridge(VipsImage *in, int *left, int *top, int *width, int *height, double r, double g, double b, double threshold) {
 #if (VIPS_MAJOR_VERSION >= 8 && VIPS_MINOR_VERSION >= 6)
 	if (vips_is_16bit(in->Type)) {
 		r = 65535 * r / 255;
@@ -703,7 +977,7 @@ int vips_find_trim_bridge(VipsImage *in, int *top, int *left, int *width, int *h
 
 	double background[3] = {r, g, b};
 	VipsArrayDouble *vipsBackground = vips_array_double_new(background, 3);
-	return vips_find_trim(in, top, left, width, height, "background", vipsBackground, "threshold", threshold, NULL);
+	return vips_find_trim(in, left, top, width, height, "background", vipsBackground, "threshold", threshold, NULL);
 #else
 	return 0;
 #endif
@@ -723,3 +997,876 @@ int vips_contrast_bridge(VipsImage *in, VipsImage **out, double k)
 {
     return vips_linear1(in, out, k , 0.0, NULL);
 }
+
+int
+vips_modulate_bridge(VipsImage *in, VipsImage **out, double brightness, double saturation, double hue, double lightness) {
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 2);
+	VipsInterpretation interpretation = vips_image_guess_interpretation(in);
+	double a[3] = {brightness, saturation, 1.0};
+	double b[3] = {lightness, 0.0, hue};
+	VipsImage *image, *alpha;
+
+	// Back to the input interpretation, which keeps 16-bit images as such
+	if (
+		vips_split_alpha(VIPS_OBJECT(base), in, &image, &alpha) ||
+		vips_colourspace(image, &t[0], VIPS_INTERPRETATION_LCH, NULL) ||
+		vips_linear(t[0], &t[1], a, b, 3, NULL) ||
+		vips_join_alpha(VIPS_OBJECT(base), t[1], out, VIPS_INTERPRETATION_LCH, interpretation, alpha)
+	) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+}
+
+int
+vips_histogram_bridge(VipsImage *in, VipsImage **out, int operation, double p0, double p1, double p2) {
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 8);
+	VipsInterpretation interpretation = vips_image_guess_interpretation(in);
+	VipsImage *image, *alpha;
+	int code = 0;
+
+	// Work on the luminance only, so that colours are not shifted
+	if (
+		vips_split_alpha(VIPS_OBJECT(base), in, &image, &alpha) ||
+		vips_colourspace(image, &t[0], VIPS_INTERPRETATION_LAB, NULL) ||
+		vips_extract_band(t[0], &t[1], 0, NULL) ||
+		vips_extract_band(t[0], &t[2], 1, "n", 2, NULL)
+	) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	if (operation == HISTOGRAM_NORMALISE) {
+		// Stretch the luminance between the given percentiles, found on a
+		// 16-bit luminance as vips_percent would round it to integers
+		double scale = 65535.0 / 100.0;
+		int min, max;
+		if (
+			vips_linear1(t[1], &t[3], scale, 0.0, NULL) ||
+			vips_cast(t[3], &t[4], VIPS_FORMAT_USHORT, NULL) ||
+			vips_percent(t[4], p0, &min) ||
+			vips_percent(t[4], p1, &max)
+		) {
+			g_object_unref(base);
+			return 1;
+		}
+		if (max > min) {
+			code = vips_linear1(t[1], &t[5], 65535.0 / (max - min), -min * 100.0 / (max - min), NULL);
+		} else {
+			code = vips_copy(t[1], &t[5], NULL);
+		}
+	} else {
+		// Histogram operations need an 8-bit luminance
+		if (
+			vips_linear1(t[1], &t[3], 255.0 / 100.0, 0.0, NULL) ||
+			vips_cast(t[3], &t[4], VIPS_FORMAT_UCHAR, NULL)
+		) {
+			g_object_unref(base);
+			return 1;
+		}
+
+		if (operation == HISTOGRAM_EQUALIZE) {
+			code = vips_hist_equal(t[4], &t[6], NULL);
+		} else {
+#if (VIPS_MAJOR_VERSION > 8 || (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION >= 5))
+			code = vips_hist_local(t[4], &t[6], (int) p0, (int) p1, "max_slope", (int) p2, NULL);
+#else
+			if (p2 > 0) {
+				vips_error("vips_histogram_bridge", "CLAHE max slope requires libvips 8.5+");
+				code = 1;
+			} else {
+				code = vips_hist_local(t[4], &t[6], (int) p0, (int) p1, NULL);
+			}
+#endif
+		}
+
+		code = code || vips_linear1(t[6], &t[5], 100.0 / 255.0, 0.0, NULL);
+	}
+
+	if (
+		code ||
+		vips_bandjoin2(t[5], t[2], &t[7], NULL) ||
+		vips_join_alpha(VIPS_OBJECT(base), t[7], out, VIPS_INTERPRETATION_LAB, interpretation, alpha)
+	) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+}
+
+static VipsInterpretation
+vips_colour_interpretation(VipsImage *in) {
+	VipsInterpretation interpretation = vips_image_guess_interpretation(in);
+	if (interpretation == VIPS_INTERPRETATION_RGB16 || interpretation == VIPS_INTERPRETATION_GREY16) {
+		return VIPS_INTERPRETATION_RGB16;
+	}
+	return VIPS_INTERPRETATION_sRGB;
+}
+
+int
+vips_greyscale_bridge(VipsImage *in, VipsImage **out) {
+	VipsInterpretation interpretation = vips_colour_interpretation(in) == VIPS_INTERPRETATION_RGB16 ?
+		VIPS_INTERPRETATION_GREY16 : VIPS_INTERPRETATION_B_W;
+	return vips_colourspace(in, out, interpretation, NULL);
+}
+
+int
+vips_duotone_bridge(VipsImage *in, VipsImage **out, double *shadow, double *highlight) {
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 3);
+	VipsInterpretation interpretation = vips_colour_interpretation(in);
+	double a[3], b[3];
+	VipsImage *image, *alpha;
+	int i;
+
+	// Map the lightness, from 0 to 100, between the two Lab colours
+	for (i = 0; i < 3; i++) {
+		a[i] = (highlight[i] - shadow[i]) / 100.0;
+		b[i] = shadow[i];
+	}
+
+	if (
+		vips_split_alpha(VIPS_OBJECT(base), in, &image, &alpha) ||
+		vips_colourspace(image, &t[0], VIPS_INTERPRETATION_LAB, NULL) ||
+		vips_extract_band(t[0], &t[1], 0, NULL) ||
+		vips_linear(t[1], &t[2], a, b, 3, NULL) ||
+		vips_join_alpha(VIPS_OBJECT(base), t[2], out, VIPS_INTERPRETATION_LAB, interpretation, alpha)
+	) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+}
+
+int
+vips_recomb_bridge(VipsImage *in, VipsImage **out, double *matrix, int size) {
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 6);
+	VipsInterpretation interpretation = vips_colour_interpretation(in);
+	VipsImage *image = in;
+	VipsImage *alpha = NULL;
+	int code;
+
+	// Greyscale images need colour bands to be recombined
+	if (in->Bands < 3) {
+		if (vips_colourspace(in, &t[0], interpretation, NULL)) {
+			g_object_unref(base);
+			return 1;
+		}
+		image = t[0];
+	}
+
+	// 3x3 matrices leave the alpha band untouched, 4x4 ones need one
+	if (size == 3) {
+		if (vips_split_alpha(VIPS_OBJECT(base), image, &image, &alpha)) {
+			g_object_unref(base);
+			return 1;
+		}
+	} else if (!has_alpha_channel(image)) {
+		if (vips_add_alpha(image, &t[1])) {
+			g_object_unref(base);
+			return 1;
+		}
+		image = t[1];
+	}
+
+	t[5] = vips_image_new_matrix_from_array(size, size, matrix, size * size);
+	if (
+		vips_recomb(image, &t[2], t[5], NULL) ||
+		vips_cast(t[2], &t[3], image->BandFmt, NULL) ||
+		vips_copy(t[3], &t[4], "interpretation", interpretation, NULL)
+	) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	if (alpha != NULL) {
+		code = vips_bandjoin2(t[4], alpha, out, NULL);
+	} else {
+		code = vips_copy(t[4], out, NULL);
+	}
+
+	g_object_unref(base);
+	return code;
+}
+
+int
+vips_dzsave_bridge(VipsImage *in, const char *path, int layout, int tile_size, int overlap, int depth, const char *suffix) {
+	return vips_dzsave(in, path,
+		"layout", layout,
+		"tile_size", tile_size,
+		"overlap", overlap,
+		"depth", depth,
+		"suffix", suffix,
+		NULL
+	);
+}
+
+int
+vips_dzsave_buffer_bridge(VipsImage *in, void **buf, size_t *len, int layout, int tile_size, int overlap, int depth, const char *suffix) {
+#if (VIPS_MAJOR_VERSION > 8 || (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION >= 8))
+	return vips_dzsave_buffer(in, buf, len,
+		"layout", layout,
+		"tile_size", tile_size,
+		"overlap", overlap,
+		"depth", depth,
+		"suffix", suffix,
+		"container", VIPS_FOREIGN_DZ_CONTAINER_ZIP,
+		NULL
+	);
+#else
+	vips_error("vips_dzsave_buffer_bridge", "zip output requires libvips 8.8+");
+	return 1;
+#endif
+}
+
+int
+vips_image_new_from_memory_bridge(void *data, size_t len, int width, int height, int bands, int format, VipsImage **out) {
+	VipsImage *image = vips_image_new_from_memory_copy(data, len, width, height, bands, format);
+	if (image == NULL) {
+		return 1;
+	}
+
+	// libvips assumes 8-bit sRGB or B_W, tag 16-bit pixels accordingly
+	if (format == VIPS_FORMAT_USHORT) {
+		int code = vips_copy(image, out,
+			"interpretation", bands <= 2 ? VIPS_INTERPRETATION_GREY16 : VIPS_INTERPRETATION_RGB16,
+			NULL);
+		g_object_unref(image);
+		return code;
+	}
+
+	*out = image;
+	return 0;
+}
+
+// vips_rgba_background returns the image to extend with the given
+// background, with an opaque alpha band added if the background is not
+// opaque, and the background values matching its bands and format.
+static int
+vips_rgba_background(VipsImage *in, VipsImage **out, VipsArrayDouble **background, double r, double g, double b, double a) {
+	double max = vips_is_16bit(in->Type) ? 65535.0 : 255.0;
+	double values[4];
+	int n = 0;
+
+	// Add an opaque alpha band so the background can be transparent
+	if (a < 255 && has_alpha_channel(in) == 0) {
+		if (vips_add_alpha(in, out)) {
+			return 1;
+		}
+	} else {
+		g_object_ref(in);
+		*out = in;
+	}
+
+	values[n++] = r * max / 255;
+	if ((*out)->Bands > 2) {
+		values[n++] = g * max / 255;
+		values[n++] = b * max / 255;
+	}
+	if (has_alpha_channel(*out) == 1) {
+		values[n++] = a * max / 255;
+	}
+
+	*background = vips_array_double_new(values, n);
+	return 0;
+}
+
+int
+vips_similarity_bridge(VipsImage *in, VipsImage **out, double angle, VipsInterpolate *interpolator, double r, double g, double b, double a) {
+#if (VIPS_MAJOR_VERSION > 8 || (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION >= 6))
+	VipsImage *image;
+	VipsArrayDouble *background;
+	int code;
+
+	if (vips_rgba_background(in, &image, &background, r, g, b, a)) {
+		return 1;
+	}
+
+	code = vips_similarity(image, out,
+		"angle", angle,
+		"interpolate", interpolator,
+		"background", background,
+		NULL
+	);
+
+	vips_area_unref(VIPS_AREA(background));
+	g_object_unref(image);
+	return code;
+#else
+	vips_error("vips_similarity_bridge", "arbitrary rotation requires libvips 8.6+");
+	return 1;
+#endif
+}
+
+int
+vips_embed_rgba_bridge(VipsImage *in, VipsImage **out, int left, int top, int width, int height, double r, double g, double b, double a) {
+	VipsImage *image;
+	VipsArrayDouble *background;
+	int code;
+
+	if (vips_rgba_background(in, &image, &background, r, g, b, a)) {
+		return 1;
+	}
+
+	code = vips_embed(image, out, left, top, width, height,
+		"extend", VIPS_EXTEND_BACKGROUND,
+		"background", background,
+		NULL
+	);
+
+	vips_area_unref(VIPS_AREA(background));
+	g_object_unref(image);
+	return code;
+}
+
+int
+vips_find_trim_alpha_bridge(VipsImage *in, int *left, int *top, int *width, int *height, double threshold) {
+#if (VIPS_MAJOR_VERSION > 8 || (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION >= 6))
+	VipsImage *alpha;
+	double background[1] = {0.0};
+	int code;
+
+	// Nothing is transparent, keep the whole image
+	if (has_alpha_channel(in) == 0) {
+		*left = 0;
+		*top = 0;
+		*width = in->Xsize;
+		*height = in->Ysize;
+		return 0;
+	}
+
+	if (vips_extract_band(in, &alpha, in->Bands - 1, NULL)) {
+		return 1;
+	}
+
+	VipsArrayDouble *vipsBackground = vips_array_double_new(background, 1);
+	code = vips_find_trim(alpha, left, top, width, height,
+		"background", vipsBackground,
+		"threshold", threshold,
+		NULL
+	);
+
+	vips_area_unref(VIPS_AREA(vipsBackground));
+	g_object_unref(alpha);
+	return code;
+#else
+	vips_error("vips_find_trim_alpha_bridge", "trimming requires libvips 8.6+");
+	return 1;
+#endif
+}
+
+int
+vips_affine_transform_bridge(VipsImage *in, VipsImage **out, double a, double b, double c, double d, double odx, double ody, int left, int top, int width, int height, VipsInterpolate *interpolator, int extend) {
+	int area[4] = {left, top, width, height};
+	VipsArrayInt *oarea = vips_array_int_new(area, 4);
+	int code = vips_affine(in, out, a, b, c, d,
+		"interpolate", interpolator,
+		"odx", odx,
+		"ody", ody,
+		"oarea", oarea,
+		"extend", extend,
+		NULL
+	);
+	vips_area_unref(VIPS_AREA(oarea));
+	return code;
+}
+
+int
+vips_perspective_bridge(VipsImage *in, VipsImage **out, int width, int height, double *matrix, VipsInterpolate *interpolator) {
+#if (VIPS_MAJOR_VERSION > 8 || (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION >= 7))
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 7);
+
+	// Map every output pixel to its source coordinates with the homography:
+	// [x*w, y*w, w] = matrix * [u, v, 1], then divide by w
+	t[0] = vips_image_new_matrix_from_array(3, 3, matrix, 9);
+	if (t[0] == NULL ||
+		vips_xyz(&t[1], width, height, NULL) ||
+		vips_bandjoin_const1(t[1], &t[2], 1.0, NULL) ||
+		vips_recomb(t[2], &t[3], t[0], NULL) ||
+		vips_extract_band(t[3], &t[4], 0, "n", 2, NULL) ||
+		vips_extract_band(t[3], &t[5], 2, NULL) ||
+		vips_divide(t[4], t[5], &t[6], NULL) ||
+		vips_mapim(in, out, t[6], "interpolate", interpolator, NULL)) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+#else
+	vips_error("vips_perspective_bridge", "perspective transform requires libvips 8.7+");
+	return 1;
+#endif
+}
+
+int
+vips_rounded_mask_bridge(VipsImage **out, int width, int height, double radius) {
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 12);
+	double half_width = width / 2.0;
+	double half_height = height / 2.0;
+	double ones[2] = {1.0, 1.0};
+	double centre[2] = {0.5 - half_width, 0.5 - half_height};
+	double inset[2] = {radius - half_width, radius - half_height};
+
+	// Antialiased distance of every pixel centre to the rounded corners:
+	// q = |p - centre| - (half size - radius), d = length(max(q, 0)),
+	// alpha = 255 * (radius + 0.5 - d), clipped to the 0-255 range
+	if (vips_xyz(&t[0], width, height, NULL) ||
+		vips_linear(t[0], &t[1], ones, centre, 2, NULL) ||
+		vips_abs(t[1], &t[2], NULL) ||
+		vips_linear(t[2], &t[3], ones, inset, 2, NULL) ||
+		vips_abs(t[3], &t[4], NULL) ||
+		vips_add(t[3], t[4], &t[5], NULL) ||
+		vips_multiply(t[5], t[5], &t[6], NULL) ||
+		vips_extract_band(t[6], &t[7], 0, NULL) ||
+		vips_extract_band(t[6], &t[8], 1, NULL) ||
+		vips_add(t[7], t[8], &t[9], NULL) ||
+		vips_pow_const1(t[9], &t[10], 0.5, NULL) ||
+		vips_linear1(t[10], &t[11], -127.5, 255.0 * (radius + 0.5), NULL) ||
+		vips_cast(t[11], out, VIPS_FORMAT_UCHAR, NULL)) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+}
+
+int
+vips_mask_bridge(VipsImage *in, VipsImage *mask, VipsImage **out) {
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 8);
+	double max = vips_is_16bit(in->Type) ? 65535.0 : 255.0;
+	double mask_max;
+
+	// Use the mask alpha channel, or its luminance otherwise
+	if (has_alpha_channel(mask) == 1) {
+		if (vips_extract_band(mask, &t[0], mask->Bands - 1, NULL)) {
+			g_object_unref(base);
+			return 1;
+		}
+	} else if (mask->Bands > 1) {
+		if (vips_colourspace(mask, &t[0], VIPS_INTERPRETATION_B_W, NULL)) {
+			g_object_unref(base);
+			return 1;
+		}
+	} else if (vips_copy(mask, &t[0], NULL)) {
+		g_object_unref(base);
+		return 1;
+	}
+	mask_max = t[0]->BandFmt == VIPS_FORMAT_USHORT ? 65535.0 : 255.0;
+
+	// Stretch the mask to the image size, rounding can leave it a pixel off
+	if (vips_resize(t[0], &t[1], (double) in->Xsize / t[0]->Xsize, "vscale", (double) in->Ysize / t[0]->Ysize, NULL) ||
+		vips_embed(t[1], &t[2], 0, 0, in->Xsize, in->Ysize, "extend", VIPS_EXTEND_COPY, NULL) ||
+		vips_linear1(t[2], &t[3], 1.0 / mask_max, 0, NULL)) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	// Multiply the existing alpha channel by the mask, or add it as alpha
+	if (has_alpha_channel(in) == 1) {
+		if (vips_extract_band(in, &t[4], 0, "n", in->Bands - 1, NULL) ||
+			vips_extract_band(in, &t[5], in->Bands - 1, NULL) ||
+			vips_multiply(t[5], t[3], &t[6], NULL)) {
+			g_object_unref(base);
+			return 1;
+		}
+	} else if (vips_copy(in, &t[4], NULL) || vips_linear1(t[3], &t[6], max, 0, NULL)) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	if (vips_cast(t[6], &t[7], in->BandFmt, NULL) ||
+		vips_bandjoin2(t[4], t[7], out, NULL)) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+}
+
+int
+vips_composite_layer_bridge(VipsImage *in, VipsImage *layer, VipsImage **out, int left, int top, int tile, double opacity, int mode) {
+#if (VIPS_MAJOR_VERSION > 8 || (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION >= 6))
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 7);
+	int bands;
+
+	// Ensure the layer has an alpha channel, scaled by the opacity
+	if (has_alpha_channel(layer) == 1) {
+		if (vips_copy(layer, &t[0], NULL)) {
+			g_object_unref(base);
+			return 1;
+		}
+	} else if (vips_add_alpha(layer, &t[0])) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	bands = t[0]->Bands;
+	if (opacity < 1) {
+		double *a = VIPS_ARRAY(base, bands, double);
+		double *b = VIPS_ARRAY(base, bands, double);
+		int i;
+		for (i = 0; i < bands; i++) {
+			a[i] = 1.0;
+			b[i] = 0.0;
+		}
+		a[bands - 1] = opacity;
+		if (vips_linear(t[0], &t[1], a, b, bands, NULL) ||
+			vips_cast(t[1], &t[2], t[0]->BandFmt, NULL)) {
+			g_object_unref(base);
+			return 1;
+		}
+	} else if (vips_copy(t[0], &t[2], NULL)) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	if (tile) {
+		// Repeat the layer over the whole image, starting at left/top
+		int width = t[2]->Xsize;
+		int height = t[2]->Ysize;
+		int x = ((left % width) + width) % width;
+		int y = ((top % height) + height) % height;
+		int across = (in->Xsize + x) / width + 2;
+		int down = (in->Ysize + y) / height + 2;
+		if (vips_replicate(t[2], &t[3], across, down, NULL) ||
+			vips_extract_area(t[3], &t[4], (width - x) % width, (height - y) % height, in->Xsize, in->Ysize, NULL)) {
+			g_object_unref(base);
+			return 1;
+		}
+	} else if (vips_embed(t[2], &t[4], left, top, in->Xsize, in->Ysize, "extend", VIPS_EXTEND_BLACK, NULL)) {
+		// The layer is surrounded by fully transparent pixels
+		g_object_unref(base);
+		return 1;
+	}
+
+	if (vips_composite2(in, t[4], &t[5], mode, NULL)) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	// Compositing adds an alpha channel, drop it if the image had none
+	if (has_alpha_channel(in) == 0) {
+		if (vips_extract_band(t[5], out, 0, "n", t[5]->Bands - 1, NULL)) {
+			g_object_unref(base);
+			return 1;
+		}
+	} else if (vips_copy(t[5], out, NULL)) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+#else
+	vips_error("vips_composite_layer_bridge", "compositing requires libvips 8.6+");
+	return 1;
+#endif
+}
+
+int
+vips_text_layer_bridge(VipsImage **out, TextLayerOptions *o) {
+#if (VIPS_MAJOR_VERSION > 8 || (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION >= 6))
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 14);
+	double ones[4] = {1, 1, 1, 1};
+	double colour[3] = {o->Color[0], o->Color[1], o->Color[2]};
+	double transparent[4] = {0, 0, 0, 0};
+	VipsImage *layer;
+
+	if (o->Rgba) {
+		// The text is rendered with its own colours
+		if (
+			vips_text_render(&t[0], o) ||
+			vips_copy(t[0], &t[6], "interpretation", VIPS_INTERPRETATION_sRGB, NULL)
+		) {
+			g_object_unref(base);
+			return 1;
+		}
+	} else if (
+		// Paint the text colour through the rendered text, used as alpha
+		vips_text_render(&t[0], o) ||
+		vips_black(&t[1], t[0]->Xsize, t[0]->Ysize, "bands", 3, NULL) ||
+		vips_linear(t[1], &t[2], ones, colour, 3, NULL) ||
+		vips_linear1(t[0], &t[3], o->Color[3] / 255.0, 0.0, NULL) ||
+		vips_bandjoin2(t[2], t[3], &t[4], NULL) ||
+		vips_cast(t[4], &t[5], VIPS_FORMAT_UCHAR, NULL) ||
+		vips_copy(t[5], &t[6], "interpretation", VIPS_INTERPRETATION_sRGB, NULL)
+	) {
+		g_object_unref(base);
+		return 1;
+	}
+	layer = t[6];
+
+	// Draw the box behind the text
+	if (o->HasBox) {
+		int width = layer->Xsize + 2 * o->Padding;
+		int height = layer->Ysize + 2 * o->Padding;
+		if (
+			vips_black(&t[7], width, height, "bands", 4, NULL) ||
+			vips_linear(t[7], &t[8], ones, o->Box, 4, NULL) ||
+			vips_cast(t[8], &t[9], VIPS_FORMAT_UCHAR, NULL) ||
+			vips_copy(t[9], &t[10], "interpretation", VIPS_INTERPRETATION_sRGB, NULL) ||
+			vips_embed(layer, &t[11], o->Padding, o->Padding, width, height, "extend", VIPS_EXTEND_BLACK, NULL) ||
+			vips_composite2(t[10], t[11], &t[12], VIPS_BLEND_MODE_OVER, NULL)
+		) {
+			g_object_unref(base);
+			return 1;
+		}
+		layer = t[12];
+	}
+
+	if (o->Angle != 0) {
+		VipsArrayDouble *background = vips_array_double_new(transparent, 4);
+		int code = vips_similarity(layer, &t[13], "angle", o->Angle, "background", background, NULL);
+		vips_area_unref(VIPS_AREA(background));
+		if (code) {
+			g_object_unref(base);
+			return 1;
+		}
+		layer = t[13];
+	}
+
+	if (vips_copy(layer, out, NULL)) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+#else
+	vips_error("vips_text_layer_bridge", "text layers require libvips 8.6+");
+	return 1;
+#endif
+}
+
+int
+vips_text_measure_bridge(TextLayerOptions *o, int *width, int *height) {
+	VipsImage *text;
+
+	if (vips_text_render(&text, o)) {
+		return 1;
+	}
+
+	*width = text->Xsize;
+	*height = text->Ysize;
+	g_object_unref(text);
+	return 0;
+}
+
+int
+vips_canvas_bridge(VipsImage **out, int width, int height, double *colour, int bands) {
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 3);
+	double ones[4] = {1, 1, 1, 1};
+
+	if (
+		vips_black(&t[0], width, height, "bands", bands, NULL) ||
+		vips_linear(t[0], &t[1], ones, colour, bands, NULL) ||
+		vips_cast(t[1], &t[2], VIPS_FORMAT_UCHAR, NULL) ||
+		vips_copy(t[2], out, "interpretation", VIPS_INTERPRETATION_sRGB, NULL)
+	) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+}
+
+int
+vips_gradient_bridge(VipsImage **out, int width, int height, int radial, double p0, double p1, double p2, double *start, double *end, int bands) {
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 16);
+	double diff[4];
+	int i;
+
+	for (i = 0; i < 4; i++) {
+		diff[i] = end[i] - start[i];
+	}
+
+	// Position of each pixel along the gradient, where 0 is the start colour
+	// and 1 the end one. Radial gradients use the distance to the centre
+	// (p0, p1) over the radius p2, linear ones x * p0 + y * p1 + p2.
+	if (vips_xyz(&t[0], width, height, NULL)) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	if (radial) {
+		double ones[2] = {1, 1};
+		double centre[2] = {-p0, -p1};
+		t[15] = vips_image_new_matrix_from_array(2, 1, ones, 2);
+		if (
+			vips_linear(t[0], &t[1], ones, centre, 2, NULL) ||
+			vips_multiply(t[1], t[1], &t[2], NULL) ||
+			vips_recomb(t[2], &t[3], t[15], NULL) ||
+			vips_pow_const1(t[3], &t[4], 0.5, NULL) ||
+			vips_linear1(t[4], &t[5], 1.0 / p2, 0.0, NULL)
+		) {
+			g_object_unref(base);
+			return 1;
+		}
+	} else {
+		double coefficients[2] = {p0, p1};
+		t[15] = vips_image_new_matrix_from_array(2, 1, coefficients, 2);
+		if (
+			vips_recomb(t[0], &t[3], t[15], NULL) ||
+			vips_linear1(t[3], &t[5], 1.0, p2, NULL)
+		) {
+			g_object_unref(base);
+			return 1;
+		}
+	}
+
+	// Clamp the position, as max(f, 0) = (f + |f|) / 2 and
+	// min(f, 1) = (f + 1 - |f - 1|) / 2, then map it to the colours
+	if (
+		vips_abs(t[5], &t[6], NULL) ||
+		vips_add(t[5], t[6], &t[7], NULL) ||
+		vips_linear1(t[7], &t[8], 0.5, 0.0, NULL) ||
+		vips_linear1(t[8], &t[9], 1.0, -1.0, NULL) ||
+		vips_abs(t[9], &t[10], NULL) ||
+		vips_subtract(t[8], t[10], &t[11], NULL) ||
+		vips_linear1(t[11], &t[12], 0.5, 0.5, NULL) ||
+		vips_linear(t[12], &t[13], diff, start, bands, NULL) ||
+		vips_cast(t[13], &t[14], VIPS_FORMAT_UCHAR, NULL) ||
+		vips_copy(t[14], out, "interpretation", VIPS_INTERPRETATION_sRGB, NULL)
+	) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+}
+
+int
+vips_arrayjoin_bridge(VipsImage **in, int n, VipsImage **out, int across, int shim, int hspacing, int vspacing, int halign, int valign, double *background, int alpha) {
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 3 * n);
+	int i;
+
+	// Take ownership of the input images
+	for (i = 0; i < n; i++) {
+		t[2 * n + i] = in[i];
+	}
+
+#if (VIPS_MAJOR_VERSION > 8 || (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION >= 6))
+	VipsImage **images = g_new(VipsImage *, n);
+	VipsArrayDouble *vipsBackground;
+	int code;
+
+	// Bring the images to the same colour space and bands, as libvips would
+	// otherwise pad missing alpha bands with transparent pixels
+	for (i = 0; i < n; i++) {
+		if (vips_colourspace(in[i], &t[i], VIPS_INTERPRETATION_sRGB, NULL)) {
+			g_free(images);
+			g_object_unref(base);
+			return 1;
+		}
+		images[i] = t[i];
+		if (alpha && has_alpha_channel(t[i]) == 0) {
+			if (vips_add_band(t[i], &t[n + i], 255.0)) {
+				g_free(images);
+				g_object_unref(base);
+				return 1;
+			}
+			images[i] = t[n + i];
+		}
+	}
+
+	vipsBackground = vips_array_double_new(background, alpha ? 4 : 3);
+	code = vips_arrayjoin(images, out, n,
+		"across", across,
+		"shim", shim,
+		"hspacing", hspacing,
+		"vspacing", vspacing,
+		"halign", halign,
+		"valign", valign,
+		"background", vipsBackground,
+		NULL
+	);
+	vips_area_unref(VIPS_AREA(vipsBackground));
+	g_free(images);
+
+	g_object_unref(base);
+	return code;
+#else
+	g_object_unref(base);
+	vips_error("vips_arrayjoin_bridge", "joining images requires libvips 8.6+");
+	return 1;
+#endif
+}
+
+int
+vips_sprite_bridge(VipsImage *sheet, VipsImage **in, int n, VipsImage **out, int *left, int *top, double *background) {
+	VipsImage *base = vips_image_new();
+	VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 4 * n + 1);
+	VipsImage *image = sheet;
+	int alpha = has_alpha_channel(sheet);
+	int i;
+
+	// Take ownership of the sheet and the input images
+	t[4 * n] = sheet;
+	for (i = 0; i < n; i++) {
+		t[3 * n + i] = in[i];
+	}
+
+	// Images do not overlap, so each one is inserted in place once it has
+	// the bands of the sheet. Without alpha channel on the sheet, images are
+	// flattened onto the background, as compositing them would do.
+	for (i = 0; i < n; i++) {
+		VipsImage *item;
+
+		if (vips_colourspace(in[i], &t[i], VIPS_INTERPRETATION_sRGB, NULL)) {
+			g_object_unref(base);
+			return 1;
+		}
+		item = t[i];
+
+		if (alpha && has_alpha_channel(item) == 0) {
+			if (vips_add_band(item, &t[n + i], 255.0)) {
+				g_object_unref(base);
+				return 1;
+			}
+			item = t[n + i];
+		} else if (!alpha && has_alpha_channel(item) == 1) {
+			if (vips_flatten_background_brigde(item, &t[n + i], background[0], background[1], background[2])) {
+				g_object_unref(base);
+				return 1;
+			}
+			item = t[n + i];
+		}
+
+		if (vips_insert(image, item, &t[2 * n + i], left[i], top[i], NULL)) {
+			g_object_unref(base);
+			return 1;
+		}
+		image = t[2 * n + i];
+	}
+
+	if (vips_copy(image, out, NULL)) {
+		g_object_unref(base);
+		return 1;
+	}
+
+	g_object_unref(base);
+	return 0;
+}